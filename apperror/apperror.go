@@ -0,0 +1,208 @@
+// Package apperror defines application errors and the middleware turning
+// them into RFC 7807 problem responses. Handlers abort with an error and
+// leave writing the response to the middleware, so clients always get the
+// same envelope and internal causes stay in the logs.
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// stable codes shared by every package, packages add their own for
+// errors clients need to tell apart
+const (
+	CodeBadRequest   = "bad_request"
+	CodeInvalidBody  = "invalid_body"
+	CodeInvalidParam = "invalid_parameter"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeRateLimited  = "rate_limited"
+	CodeInternal     = "internal_error"
+	CodeUnavailable  = "service_unavailable"
+)
+
+// Error is an error with the response it maps to. Detail is returned to
+// the client, Err is the internal cause which is only logged.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Err    error
+	// Extensions are extra members of the problem, such as field errors
+	Extensions map[string]interface{}
+}
+
+// New creates an error responding with status
+func New(status int, code string, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest creates a 400 error
+func BadRequest(code string, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// Unauthorized creates a 401 error
+func Unauthorized(code string, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+// Forbidden creates a 403 error
+func Forbidden(code string, detail string) *Error {
+	return New(http.StatusForbidden, code, detail)
+}
+
+// NotFound creates a 404 error
+func NotFound(code string, detail string) *Error {
+	return New(http.StatusNotFound, code, detail)
+}
+
+// Conflict creates a 409 error
+func Conflict(code string, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// Internal creates a 500 error hiding its cause from the client
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: "internal server error", Err: err}
+}
+
+// Unavailable creates a 503 error for a backing service that can't be
+// reached, such as the token store
+func Unavailable(detail string) *Error {
+	return New(http.StatusServiceUnavailable, CodeUnavailable, detail)
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+// Unwrap returns the internal cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the same kind of error, copies made by
+// Wrap and With match the error they were made from
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == e.Status && t.Code == e.Code
+}
+
+// Wrap returns a copy of e with the internal cause err
+func (e *Error) Wrap(err error) *Error {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+// With returns a copy of e with an extension member
+func (e *Error) With(key string, value interface{}) *Error {
+	cp := *e
+	cp.Extensions = map[string]interface{}{}
+	for k, v := range e.Extensions {
+		cp.Extensions[k] = v
+	}
+	cp.Extensions[key] = value
+	return &cp
+}
+
+// Abort stops the request with err, the middleware writes the response.
+// Errors other than *Error respond 500 without details.
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// Problem represents RFC 7807 problem details. Code is stable for clients
+// to match on, RequestID ties the response to the server logs.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Extensions are extra members, such as field errors, written next to
+	// the standard ones which they can't replace
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON writes the standard members and the extensions as one object
+func (p Problem) MarshalJSON() ([]byte, error) {
+	// problem has the fields but not this method
+	type problem Problem
+	b, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		out[k] = v
+	}
+	for k, v := range members {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+// Middleware writes the last error of the request as problem response,
+// unless a response was already written
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		var e *Error
+		if !errors.As(err, &e) {
+			e = Internal(err)
+		}
+
+		l := logger.Extract(c)
+		if e.Status >= http.StatusInternalServerError {
+			l.Error("request failed", logger.Plain("code", e.Code), zap.Error(err))
+		} else if e.Err != nil {
+			l.Info("request rejected", logger.Plain("code", e.Code), zap.Error(err))
+		}
+
+		c.Header("Content-Type", ContentType)
+		c.JSON(e.Status, e.problem(c))
+	}
+}
+
+// problem returns the response body of e
+func (e *Error) problem(c *gin.Context) Problem {
+	return Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(e.Status),
+		Status:     e.Status,
+		Detail:     e.Detail,
+		Instance:   c.Request.URL.Path,
+		Code:       e.Code,
+		RequestID:  logger.RequestID(c),
+		Extensions: e.Extensions,
+	}
+}
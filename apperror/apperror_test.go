@@ -0,0 +1,104 @@
+package apperror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var errNotFound = apperror.NotFound("thing_not_found", "thing not found")
+
+func serve(handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logger.Middleware(zap.NewNop()))
+	r.Use(apperror.Middleware())
+	r.GET("/things/:id", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+	req.Header.Set(logger.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func problem(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	assert.Equal(t, apperror.ContentType, rec.Header().Get("Content-Type"))
+	p := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return p
+}
+
+func TestMiddlewareWritesProblem(t *testing.T) {
+	rec := serve(func(c *gin.Context) {
+		apperror.Abort(c, errNotFound.Wrap(errors.New("select failed")).With("id", c.Param("id")))
+	})
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, map[string]interface{}{
+		"type":       "about:blank",
+		"title":      "Not Found",
+		"status":     float64(http.StatusNotFound),
+		"detail":     "thing not found",
+		"instance":   "/things/1",
+		"code":       "thing_not_found",
+		"request_id": "req-1",
+		"id":         "1",
+	}, problem(t, rec))
+}
+
+func TestMiddlewareHidesInternalErrors(t *testing.T) {
+	rec := serve(func(c *gin.Context) {
+		apperror.Abort(c, errors.New("mssql: login failed for user sert11"))
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	p := problem(t, rec)
+	assert.Equal(t, apperror.CodeInternal, p["code"])
+	assert.NotContains(t, rec.Body.String(), "mssql")
+}
+
+func TestMiddlewareKeepsWrittenResponse(t *testing.T) {
+	rec := serve(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+		_ = c.Error(errors.New("after the response"))
+	})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"message":"ok"}`, rec.Body.String())
+}
+
+func TestErrorIsMatchesCopies(t *testing.T) {
+	cause := errors.New("cause")
+	err := errNotFound.Wrap(cause).With("id", 1)
+
+	assert.True(t, errors.Is(err, errNotFound))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, apperror.NotFound("other", "other")))
+	assert.Nil(t, errNotFound.Err)
+	assert.Nil(t, errNotFound.Extensions)
+}
+
+func TestProblemExtensionsKeepStandardMembers(t *testing.T) {
+	b, err := json.Marshal(apperror.Problem{
+		Type:       "about:blank",
+		Title:      "Bad Request",
+		Status:     http.StatusBadRequest,
+		Code:       apperror.CodeValidation,
+		Extensions: map[string]interface{}{"status": 200, "errors": []string{"name"}},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Bad Request","status":400,"code":"validation_failed","errors":["name"]}`, string(b))
+
+	b, err = json.Marshal(apperror.Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Code: "thing_not_found"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"code":"thing_not_found"}`, string(b))
+}
@@ -0,0 +1,197 @@
+// Package audit records security relevant events such as logins and
+// account changes. Events are append-only, nothing updates or deletes them.
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// actions of events
+const (
+	ActionLogin             = "auth.login"
+	ActionLogout            = "auth.logout"
+	ActionPasswordReset     = "auth.password_reset"
+	ActionTwoFactorEnable   = "auth.2fa_enable"
+	ActionTwoFactorDisable  = "auth.2fa_disable"
+	ActionUnlock            = "auth.unlock"
+	ActionSessionRevoke     = "auth.session_revoke"
+	ActionAPIKeyCreate      = "auth.apikey_create"
+	ActionAPIKeyDelete      = "auth.apikey_delete"
+	ActionOAuthClientCreate = "auth.oauth_client_create"
+	ActionOAuthClientDelete = "auth.oauth_client_delete"
+	ActionUserCreate        = "user.create"
+	ActionUserUpdate        = "user.update"
+	ActionPasswordChange    = "user.password_change"
+	ActionUserDelete        = "user.delete"
+	ActionRoleUpdate        = "user.role_update"
+	ActionPostCreate        = "post.create"
+	ActionPostUpdate        = "post.update"
+	ActionPostDelete        = "post.delete"
+)
+
+// outcomes of events
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// types of targets
+const (
+	TargetUser        = "user"
+	TargetPost        = "post"
+	TargetSession     = "session"
+	TargetAPIKey      = "api_key"
+	TargetOAuthClient = "oauth_client"
+)
+
+// Event is one audit record. ActorID is the authenticated user, it is
+// empty for anonymous requests such as failed logins, where Actor holds
+// the username that was tried. Detail explains the outcome, such as why
+// a login failed.
+type Event struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	ActorID    string    `gorm:"size:20;index" json:"actor_id"`
+	Actor      string    `gorm:"size:100" json:"actor,omitempty"`
+	Action     string    `gorm:"size:50;index" json:"action"`
+	TargetType string    `gorm:"size:20" json:"target_type,omitempty"`
+	TargetID   string    `gorm:"size:50;index" json:"target_id,omitempty"`
+	Outcome    string    `gorm:"size:10" json:"outcome"`
+	Detail     string    `gorm:"size:255" json:"detail,omitempty"`
+	IP         string    `gorm:"size:45" json:"ip"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	RequestID  string    `gorm:"size:128" json:"request_id"`
+}
+
+// TableName keeps audit events apart from the tables of other packages
+func (Event) TableName() string {
+	return "audit_events"
+}
+
+// Log writes and queries audit events
+type Log struct {
+	DB *gorm.DB
+}
+
+// Record stores the event with details of the request. Failing to store
+// it is logged but doesn't fail the request. A nil Log records nothing so
+// handlers work without auditing in tests.
+func (l *Log) Record(c *gin.Context, e Event) {
+	if l == nil {
+		return
+	}
+	if e.ActorID == "" {
+		e.ActorID = c.GetString("uid")
+	}
+	if e.Outcome == "" {
+		e.Outcome = Success
+	}
+	e.IP = c.ClientIP()
+	e.UserAgent = truncate(c.Request.UserAgent(), 255)
+	e.RequestID = logger.RequestID(c)
+	e.Actor = truncate(e.Actor, 100)
+	e.Detail = truncate(e.Detail, 255)
+
+	if err := l.DB.WithContext(c.Request.Context()).Create(&e).Error; err != nil {
+		logger.Extract(c).Error("can't record audit event", zap.String("action", e.Action), zap.Error(err))
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// pagination limits of List
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// errors of List
+var (
+	errInvalidTime   = apperror.BadRequest(apperror.CodeInvalidParam, "since and until must be RFC 3339 time")
+	errInvalidCursor = apperror.BadRequest(apperror.CodeInvalidParam, "invalid cursor")
+	errInvalidLimit  = apperror.BadRequest(apperror.CodeInvalidParam, "invalid limit")
+)
+
+// ListResponse represents a page of events, NextCursor is empty on the
+// last page
+type ListResponse struct {
+	Events     []Event `json:"events"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+// List handle list audit events request, newest first. Events can be
+// filtered by actor_id, action, target_type, target_id, outcome, ip and
+// a since/until time range, pages continue from the cursor of the
+// previous one.
+func (l *Log) List(c *gin.Context) {
+	conds := map[string]interface{}{}
+	for _, f := range []string{"actor_id", "action", "target_type", "target_id", "outcome", "ip"} {
+		if v := c.Query(f); v != "" {
+			conds[f+" = ?"] = v
+		}
+	}
+	for param, cond := range map[string]string{"since": "created_at >= ?", "until": "created_at < ?"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apperror.Abort(c, errInvalidTime.With("parameter", param))
+			return
+		}
+		conds[cond] = t.UTC()
+	}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			apperror.Abort(c, errInvalidCursor)
+			return
+		}
+		conds["id < ?"] = cursor
+	}
+
+	limit := defaultLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			apperror.Abort(c, errInvalidLimit)
+			return
+		}
+		if n < maxLimit {
+			limit = n
+		} else {
+			limit = maxLimit
+		}
+	}
+
+	q := l.DB.WithContext(c.Request.Context())
+	for cond, v := range conds {
+		q = q.Where(cond, v)
+	}
+	// one extra row tells whether there is a next page
+	events := []Event{}
+	if err := q.Order("id DESC").Limit(limit + 1).Find(&events).Error; err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	res := ListResponse{Events: events}
+	if len(events) > limit {
+		res.Events = events[:limit]
+		res.NextCursor = strconv.FormatUint(uint64(res.Events[limit-1].ID), 10)
+	}
+	c.JSON(http.StatusOK, res)
+}
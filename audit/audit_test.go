@@ -0,0 +1,149 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/database"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func TestNilLogRecordsNothing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var l *audit.Log
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	assert.NotPanics(t, func() {
+		l.Record(c, audit.Event{Action: audit.ActionLogin})
+	})
+}
+
+func TestListRejectsBadFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := &audit.Log{}
+
+	r := gin.New()
+	r.Use(apperror.Middleware())
+	r.GET("/admin/audit", l.List)
+
+	for _, query := range []string{
+		"since=yesterday",
+		"until=2021-13-01",
+		"cursor=abc",
+		"limit=0",
+		"limit=-5",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+// open returns a log on an empty in-memory database
+func open(t *testing.T) *audit.Log {
+	db, err := database.Open("", "sqlite://file::memory:", &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a new database
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&audit.Event{}); err != nil {
+		t.Fatal(err)
+	}
+	return &audit.Log{DB: db}
+}
+
+func TestRecordKeepsRequestDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := open(t)
+
+	r := gin.New()
+	r.Use(logger.Middleware(zap.NewNop()))
+	r.POST("/users/:uid/posts", func(c *gin.Context) {
+		c.Set("uid", "4")
+		l.Record(c, audit.Event{Action: audit.ActionPostCreate, TargetType: audit.TargetPost, TargetID: "7"})
+	})
+	req := httptest.NewRequest(http.MethodPost, "/users/4/posts", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	req.Header.Set(logger.RequestIDHeader, "request-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	events := []audit.Event{}
+	assert.NoError(t, l.DB.Find(&events).Error)
+	if assert.Len(t, events, 1) {
+		e := events[0]
+		assert.Equal(t, "4", e.ActorID)
+		assert.Equal(t, audit.ActionPostCreate, e.Action)
+		assert.Equal(t, audit.Success, e.Outcome)
+		assert.Equal(t, "192.0.2.7", e.IP)
+		assert.Equal(t, "test-agent/1.0", e.UserAgent)
+		assert.Equal(t, "request-1", e.RequestID)
+	}
+}
+
+func TestListFiltersAndPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := open(t)
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := audit.Event{
+			CreatedAt: start.Add(time.Hour * time.Duration(i)),
+			ActorID:   strconv.Itoa(i % 2),
+			Action:    audit.ActionLogin,
+			Outcome:   audit.Success,
+		}
+		if i == 4 {
+			e.Action, e.Outcome = audit.ActionLogout, audit.Failure
+		}
+		assert.NoError(t, l.DB.Create(&e).Error)
+	}
+
+	r := gin.New()
+	r.Use(apperror.Middleware())
+	r.GET("/admin/audit", l.List)
+	list := func(query string) audit.ListResponse {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		res := audit.ListResponse{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res
+	}
+	ids := func(res audit.ListResponse) []uint {
+		ids := []uint{}
+		for _, e := range res.Events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	// newest first, the cursor continues where the page ended
+	page := list("limit=2")
+	assert.Equal(t, []uint{5, 4}, ids(page))
+	assert.Equal(t, "4", page.NextCursor)
+	page = list("limit=2&cursor=" + page.NextCursor)
+	assert.Equal(t, []uint{3, 2}, ids(page))
+	page = list("limit=2&cursor=" + page.NextCursor)
+	assert.Equal(t, []uint{1}, ids(page))
+	assert.Empty(t, page.NextCursor)
+
+	assert.Equal(t, []uint{5, 3, 1}, ids(list("actor_id=0")))
+	assert.Equal(t, []uint{4, 3, 2, 1}, ids(list("action="+audit.ActionLogin)))
+	assert.Equal(t, []uint{5}, ids(list("outcome="+audit.Failure)))
+	// since is inclusive and until exclusive
+	assert.Equal(t, []uint{3, 2}, ids(list("since=2021-03-01T01:00:00Z&until=2021-03-01T03:00:00Z")))
+	assert.Equal(t, []uint{2}, ids(list("actor_id=1&until=2021-03-01T03:00:00Z")))
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// apiKeyPrefix starts every API key so it is recognized in the
+// Authorization header and by secret scanners
+const apiKeyPrefix = "sgk_"
+
+// lastUsedResolution limits how often last used time is written
+const lastUsedResolution = time.Minute
+
+// APIKey is a long-lived credential a user creates for scripts. Only the
+// hash of the key is stored, Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `gorm:"size:100" json:"name"`
+	Prefix     string     `gorm:"size:20" json:"prefix"`
+	Hash       string     `gorm:"size:64;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"size:255" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// APIKeyRequest represents create API key request body
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyResponse represents an API key, Key is only set on creation
+type APIKeyResponse struct {
+	APIKey
+	Scopes []string `json:"scopes"`
+	Key    string   `json:"key,omitempty"`
+}
+
+func (k APIKey) response() APIKeyResponse {
+	return APIKeyResponse{APIKey: k, Scopes: k.scopes()}
+}
+
+func (k APIKey) scopes() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// newAPIKey returns a random key and its visible prefix
+func newAPIKey() (string, string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// lookupAPIKey resolves an API key to a session like identity of its
+// user, the role is read from the database so role changes apply at once
+func (h *Handler) lookupAPIKey(ctx context.Context, key string) (Session, APIKey, error) {
+	db := h.DB.WithContext(ctx)
+
+	k := APIKey{}
+	if result := db.Where("hash = ?", hashToken(key)).Limit(1).Find(&k); result.Error != nil {
+		return Session{}, k, result.Error
+	} else if result.RowsAffected == 0 {
+		return Session{}, k, ErrSessionNotFound
+	}
+	u := user.User{}
+	if result := db.Select("id", "role").Limit(1).Find(&u, k.UserID); result.Error != nil {
+		return Session{}, k, result.Error
+	} else if result.RowsAffected == 0 {
+		return Session{}, k, ErrSessionNotFound
+	}
+
+	return Session{UserID: strconv.Itoa(int(u.ID)), Role: u.Role}, k, nil
+}
+
+// lookupDelegated resolves API keys and access tokens issued to OAuth
+// clients, credentials acting for a user within their granted scopes
+func (h *Handler) lookupDelegated(c *gin.Context, token string) (Session, []string, error) {
+	if isOAuthToken(token) {
+		s, t, err := h.lookupOAuthToken(c.Request.Context(), token)
+		return s, splitList(t.Scopes), err
+	}
+
+	s, k, err := h.lookupAPIKey(c.Request.Context(), token)
+	if err != nil {
+		return s, nil, err
+	}
+	// record usage at most once per resolution to keep hot keys cheap
+	now := time.Now().UTC()
+	if result := h.DB.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", k.ID, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now); result.Error != nil {
+		logger.Extract(c).Warn("can't update api key last used", zap.Uint("kid", k.ID), zap.Error(result.Error))
+	}
+	return s, k.scopes(), nil
+}
+
+// authorizeDelegated is Authorize for delegated credentials, it also
+// sets the granted scopes to context for RequireScope
+func (h *Handler) authorizeDelegated(c *gin.Context, token string) {
+	s, scopes, err := h.lookupDelegated(c, token)
+	if err == ErrSessionNotFound {
+		apperror.Abort(c, errInvalidToken)
+		return
+	} else if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.Set("uid", s.UserID)
+	c.Set("role", s.Role)
+	c.Set("scopes", scopes)
+}
+
+// ListAPIKeys handle list API keys request
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	keys := []APIKey{}
+	if result := h.DB.Where("user_id = ?", c.Param("uid")).Order("id").Find(&keys); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	res := make([]APIKeyResponse, len(keys))
+	for i, k := range keys {
+		res[i] = k.response()
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// AddAPIKey handle create API key request, the key is only returned
+// in this response
+func (h *Handler) AddAPIKey(c *gin.Context) {
+	req := APIKeyRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.Name == "" {
+		apperror.Abort(c, errMissingName)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !rbac.ValidScope(s) {
+			apperror.Abort(c, errInvalidScope.With("scope", s).With("valid_scopes", rbac.Scopes()))
+			return
+		}
+	}
+
+	u, err := h.findUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	k := APIKey{
+		UserID: u.ID,
+		Name:   req.Name,
+		Prefix: prefix,
+		Hash:   hashToken(key),
+		Scopes: strings.Join(req.Scopes, ","),
+	}
+	if result := h.DB.Create(&k); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+
+	h.recordChange(c, audit.ActionAPIKeyCreate, audit.TargetAPIKey, strconv.Itoa(int(k.ID)))
+	res := k.response()
+	res.Key = key
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteAPIKey handle revoke API key request
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	result := h.DB.Where("id = ? AND user_id = ?", c.Param("kid"), c.Param("uid")).Delete(&APIKey{})
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	} else if result.RowsAffected == 0 {
+		apperror.Abort(c, errAPIKeyNotFound)
+		return
+	}
+	h.recordChange(c, audit.ActionAPIKeyDelete, audit.TargetAPIKey, c.Param("kid"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "api key revoked",
+	})
+}
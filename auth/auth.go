@@ -2,124 +2,366 @@ package auth
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
 	"example.com/social-gin/logger"
+	"example.com/social-gin/mail"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/password"
+	"example.com/social-gin/rbac"
 	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
-	"github.com/google/uuid"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 // Handler represents handler of authentication
 type Handler struct {
-	DB          *gorm.DB
-	RedisClient *redis.Client
+	DB         *gorm.DB
+	Users      user.UserRepository
+	Store      TokenStore
+	Signer     *Signer
+	Hasher     password.Hasher
+	Limiter    *Limiter
+	Tickets    TicketStore
+	Mailer     mail.Mailer
+	BaseURL    string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	ResetTTL   time.Duration
+	VerifyTTL  time.Duration
+	TOTPIssuer string
+	OIDC       map[string]*oidc.Provider
+	// VerifyBeforeLogin rejects login until the user verified their email
+	VerifyBeforeLogin bool
+	// SessionLifetime is the absolute lifetime of a session, zero for none
+	SessionLifetime time.Duration
+	// SessionIdle expires sessions without activity, zero for RefreshTTL
+	SessionIdle time.Duration
+	// Audit records logins and account changes, nil disables it
+	Audit *audit.Log
+	// CookieSessions also sets session cookies on login for browser
+	// clients, requests authenticated by them need a csrf token
+	CookieSessions bool
+	// InsecureCookies drops the Secure flag of cookies so they are sent
+	// over plain http, only for local development
+	InsecureCookies bool
+}
+
+// tokenType is the scheme clients put before the token in Authorization header
+const tokenType = "Bearer"
+
+// LoginRequest represents json login request body
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // UserAuthResponse To handler Login Response Result
 type UserAuthResponse struct {
-	Token string
+	Token        string           `json:"token"`
+	TokenType    string           `json:"token_type"`
+	ExpiresAt    time.Time        `json:"expires_at"`
+	RefreshToken string           `json:"refresh_token"`
+	User         *user.PublicUser `json:"user,omitempty"`
+}
+
+func newUserAuthResponse(tokens Tokens) UserAuthResponse {
+	return UserAuthResponse{
+		Token:        tokens.AccessToken,
+		TokenType:    tokenType,
+		ExpiresAt:    time.Now().Add(tokens.AccessTTL),
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+// loginCredentials reads credentials from a json body, or from the form
+// values u and p. A json body sent along with u or p in the query is
+// ambiguous and rejected.
+func loginCredentials(c *gin.Context) (LoginRequest, error) {
+	req := LoginRequest{}
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		if _, ok := c.GetQuery("u"); ok {
+			return req, errAmbiguousLogin
+		}
+		if _, ok := c.GetQuery("p"); ok {
+			return req, errAmbiguousLogin
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return req, validation.ErrInvalidBody.Wrap(err)
+		}
+	case "", binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		req.Username = c.Request.FormValue("u")
+		req.Password = c.Request.FormValue("p")
+	default:
+		return req, errUnsupportedLogin
+	}
+	if req.Username == "" || req.Password == "" {
+		return req, errMissingCredentials
+	}
+	return req, nil
 }
 
-var ctx = context.Background()
+// login request errors
+var (
+	errAmbiguousLogin     = apperror.BadRequest("ambiguous_credentials", "send credentials either as json or as form, not both")
+	errUnsupportedLogin   = apperror.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "login accepts application/json or form encoded body")
+	errMissingCredentials = apperror.BadRequest("missing_credentials", "username and password are required")
+)
 
-// LogIn handle login request
+// LogIn handle login request, credentials are sent either as json body
+// or as form values u and p
 func (h *Handler) LogIn(c *gin.Context) {
 
-	username := c.Request.FormValue("u")
-	password := c.Request.FormValue("p")
+	credentials, err := loginCredentials(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	username := credentials.Username
+	password := credentials.Password
 
 	l := logger.Extract(c)
 
-	l.Info(fmt.Sprint("login username=", username, " password=", password))
+	l.Info("login", zap.String("username", username))
 
-	user := user.User{}
+	if !h.allowLogin(c, username) {
+		return
+	}
 
-	if result := h.DB.Where("Username = ?", username).Limit(1).Find(&user); result.Error != nil {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	u, err := h.Users.FindByUsername(c.Request.Context(), username)
+	if errors.Is(err, user.ErrUserNotFound) {
+		// hash anyway so unknown usernames don't answer faster
+		if err := h.Hasher.VerifyDummy(password); err != nil {
+			l.Error("can't verify dummy password", zap.Error(err))
+		}
+		h.loginFailed(c, username)
 		return
-	} else if result.RowsAffected == 0 {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "invalid username or password",
-		})
+	} else if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if user.Password != password {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "invalid username or password",
-		})
+	ok, rehash, err := h.Hasher.Verify(u.Password, password)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if !ok {
+		h.loginFailed(c, username)
 		return
 	}
 
-	token := uuid.New().String()
+	// upgrade plain text or outdated hashes now that we know the password
+	if rehash {
+		if hash, err := h.Hasher.Hash(password); err != nil {
+			l.Error("can't rehash password", zap.Uint("uid", u.ID), zap.Error(err))
+		} else {
+			u.Password = hash
+			if err := h.Users.Update(c.Request.Context(), &u, "Password"); err != nil {
+				l.Error("can't store rehashed password", zap.Uint("uid", u.ID), zap.Error(err))
+			}
+		}
+	}
 
-	l.Info(fmt.Sprint("new token=", token))
+	h.firstFactorPassed(c, u)
+}
 
-	if err := h.RedisClient.Set(ctx, token, user.ID, time.Hour*3).Err(); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
+// firstFactorPassed continues a login once the user proved who they are
+// with a password or an external identity
+func (h *Handler) firstFactorPassed(c *gin.Context, u user.User) {
+	if h.VerifyBeforeLogin && u.VerifiedAt == nil {
+		h.Audit.Record(c, audit.Event{
+			Actor:   u.Username,
+			Action:  audit.ActionLogin,
+			Outcome: audit.Failure,
+			Detail:  "email not verified",
 		})
+		apperror.Abort(c, errEmailNotVerified)
 		return
 	}
-	userAuthResponse := UserAuthResponse{}
-	userAuthResponse.Token = token
-	c.JSON(http.StatusOK, userAuthResponse)
-	// c.JSON(http.StatusOK, map[string]interface{}{
-	// 	"token": token,s
-	// })
+
+	// the first factor alone isn't enough, failed attempts are only reset
+	// once the second factor is verified too
+	if u.TOTPEnabled {
+		h.challengeTwoFactor(c, u)
+		return
+	}
+
+	h.completeLogin(c, u)
 }
 
-// Authorize authenticate using authorization header
-func (h *Handler) Authorize(c *gin.Context) {
+// completeLogin starts the session of an authenticated user and responds
+// with its tokens
+func (h *Handler) completeLogin(c *gin.Context, u user.User) {
+	l := logger.Extract(c)
 
-	auth := c.GetHeader("Authorization")
-	prefix := "Bearer "
+	if h.Limiter != nil {
+		if err := h.Limiter.Reset(c.Request.Context(), u.Username); err != nil {
+			l.Warn("can't reset failed login attempts", zap.Uint("uid", u.ID), zap.Error(err))
+		}
+	}
 
-	if !strings.HasPrefix(auth, prefix) {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "no authorization token found in the header",
-		})
-		c.Abort()
+	tokens, err := h.createSession(c, u)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if h.CookieSessions {
+		if err := h.setSessionCookies(c, tokens); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	}
+
+	l.Info("login succeeded", zap.Uint("uid", u.ID), logger.Token("token", tokens.AccessToken))
+	h.Audit.Record(c, audit.Event{
+		ActorID:    strconv.Itoa(int(u.ID)),
+		Actor:      u.Username,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(int(u.ID)),
+	})
+
+	profile := u.Public()
+	res := newUserAuthResponse(tokens)
+	res.User = &profile
+	c.JSON(http.StatusOK, res)
+}
+
+// findUser returns the user by an id taken from a route, the context or
+// a ticket
+func (h *Handler) findUser(ctx context.Context, id string) (user.User, error) {
+	uid, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return user.User{}, user.ErrInvalidUserID
+	}
+	return h.Users.Get(ctx, uint(uid))
+}
+
+// recordChange writes a successful change of the target to the audit log
+func (h *Handler) recordChange(c *gin.Context, action, targetType, targetID string) {
+	h.Audit.Record(c, audit.Event{Action: action, TargetType: targetType, TargetID: targetID})
+}
+
+// Authorize authenticate using authorization header or session cookie
+func (h *Handler) Authorize(c *gin.Context) {
+
+	token, cookie, ok := h.sessionToken(c)
+	if !ok {
+		apperror.Abort(c, errMissingToken)
+		return
+	}
+	if cookie && !validCSRF(c) {
+		apperror.Abort(c, errInvalidCSRF)
 		return
 	}
 
-	token := auth[len(prefix):]
+	if !cookie && (isAPIKey(token) || isOAuthToken(token)) {
+		h.authorizeDelegated(c, token)
+		return
+	}
 
 	// validate token
 
-	var uid string
-	var err error
-	if uid, err = h.RedisClient.Get(ctx, token).Result(); err != nil {
-		// can't connect to redis
-		if err == redis.Nil {
-			c.JSON(http.StatusUnauthorized, map[string]interface{}{
-				"error": "invalid token",
-			})
+	s, claims, err := h.authenticate(c.Request.Context(), token)
+	if err != nil {
+		if err == ErrSessionNotFound || err == ErrInvalidJWT {
+			apperror.Abort(c, errInvalidToken)
 		} else {
-			c.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"error": "can't connect to redis server",
-			})
+			apperror.Abort(c, errTokenStore.Wrap(err))
 		}
-		c.Abort()
 		return
 	}
 
-	if uid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "user unauthenticated",
-		})
-		c.Abort()
+	// signed tokens are stateless, only opaque ones track activity
+	if claims == nil {
+		expiresAt, err := h.touchSession(c.Request.Context(), s, time.Now().UTC())
+		if err != nil {
+			logger.Extract(c).Warn("can't update session last seen", zap.Error(err))
+		}
+		if !expiresAt.IsZero() {
+			setSessionExpires(c, expiresAt)
+		}
+	}
+
+	// set user id and role of the authenticated user to context,
+	// ownership is checked by OwnerOr on each route
+	c.Set("uid", s.UserID)
+	c.Set("sid", s.ID)
+	c.Set("role", s.Role)
+}
+
+// Identify sets the authenticated user id to context when a valid token
+// is given, anonymous requests pass through untouched
+func (h *Handler) Identify(c *gin.Context) {
+	token, cookie, ok := h.sessionToken(c)
+	if !ok {
+		return
+	}
+	if !cookie && (isAPIKey(token) || isOAuthToken(token)) {
+		// profiles are only revealed to delegated credentials granted it
+		if s, scopes, err := h.lookupDelegated(c, token); err == nil &&
+			(hasScope(scopes, rbac.ScopeProfileRead) || hasScope(scopes, rbac.ScopeUsersRead)) {
+			c.Set("uid", s.UserID)
+			c.Set("role", s.Role)
+			c.Set("scopes", scopes)
+		}
 		return
 	}
+	if s, _, err := h.authenticate(c.Request.Context(), token); err == nil {
+		c.Set("uid", s.UserID)
+		c.Set("sid", s.ID)
+		c.Set("role", s.Role)
+	}
+}
+
+// authenticate resolves the session of an access token. Signed tokens are
+// verified locally and only checked against the denylist, claims is nil
+// for opaque tokens.
+func (h *Handler) authenticate(ctx context.Context, token string) (Session, *AccessClaims, error) {
+	if h.Signer == nil || !isJWT(token) {
+		s, err := h.Store.Lookup(ctx, token)
+		return s, nil, err
+	}
 
-	// set user id of the authenticated user to context
-	c.Set("uid", uid)
+	claims, err := h.Signer.Verify(token)
+	if err != nil {
+		return Session{}, nil, err
+	}
+	denied, err := h.Store.Denied(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		return Session{}, nil, err
+	}
+	if denied {
+		return Session{}, nil, ErrInvalidJWT
+	}
+	s := Session{
+		ID:     claims.SessionID,
+		UserID: claims.Subject,
+	}
+	if len(claims.Roles) > 0 {
+		s.Role = claims.Roles[0]
+	}
+	return s, claims, nil
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	auth := c.GetHeader("Authorization")
+	prefix := "Bearer "
+
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
 }
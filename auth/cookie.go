@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cookies of browser sessions. The access and refresh tokens are HttpOnly
+// so scripts can't read them, the csrf token is readable by the frontend
+// which echoes it in csrfHeader, a value other sites can't learn.
+const (
+	sessionCookie = "session"
+	refreshCookie = "refresh_token"
+	csrfCookie    = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+	// refreshPath limits the refresh cookie to where it is used
+	refreshPath = "/token/refresh"
+)
+
+// secureCookies tells whether cookies are only sent over https, which is
+// the default even behind a proxy terminating TLS
+func (h *Handler) secureCookies() bool {
+	return !h.InsecureCookies
+}
+
+// setSessionCookies stores tokens of a browser session in cookies with a
+// new csrf token
+func (h *Handler) setSessionCookies(c *gin.Context, tokens Tokens) error {
+	csrf, err := randomToken("")
+	if err != nil {
+		return err
+	}
+	secure := h.secureCookies()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, tokens.AccessToken, int(tokens.AccessTTL.Seconds()), "/", "", secure, true)
+	c.SetCookie(refreshCookie, tokens.RefreshToken, int(tokens.RefreshTTL.Seconds()), refreshPath, "", secure, true)
+	c.SetCookie(csrfCookie, csrf, int(tokens.RefreshTTL.Seconds()), "/", "", secure, false)
+	return nil
+}
+
+func (h *Handler) clearSessionCookies(c *gin.Context) {
+	secure := h.secureCookies()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, "/", "", secure, true)
+	c.SetCookie(refreshCookie, "", -1, refreshPath, "", secure, true)
+	c.SetCookie(csrfCookie, "", -1, "/", "", secure, false)
+}
+
+// sessionToken returns the access token from authorization header or,
+// when cookie sessions are enabled, from the session cookie
+func (h *Handler) sessionToken(c *gin.Context) (token string, cookie bool, ok bool) {
+	if token, ok := bearerToken(c); ok {
+		return token, false, true
+	}
+	if !h.CookieSessions {
+		return "", false, false
+	}
+	token, err := c.Cookie(sessionCookie)
+	if err != nil || token == "" {
+		return "", false, false
+	}
+	return token, true, true
+}
+
+// safeMethod reports whether the request method doesn't change state
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// validCSRF reports whether the request echoes the csrf cookie in the
+// csrf header, requests authenticated by cookie must on unsafe methods
+// since browsers attach cookies to cross-site requests too
+func validCSRF(c *gin.Context) bool {
+	if safeMethod(c.Request.Method) {
+		return true
+	}
+	cookie, err := c.Cookie(csrfCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := c.GetHeader(csrfHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+
+	"example.com/social-gin/apperror"
+)
+
+// errors of authentication handlers, the oauth token endpoints answer in
+// the format of RFC 6749 instead
+var (
+	errMissingToken        = apperror.Unauthorized("missing_token", "no authorization token found in the header")
+	errInvalidToken        = apperror.Unauthorized("invalid_token", "invalid token")
+	errInvalidRefreshToken = apperror.Unauthorized("invalid_refresh_token", "invalid refresh token")
+	errRefreshReused       = apperror.Unauthorized("refresh_token_reused", "refresh token reused, session revoked")
+	errMissingRefreshToken = apperror.BadRequest("missing_refresh_token", "refresh_token is empty")
+	errInvalidCredentials  = apperror.Unauthorized("invalid_credentials", "invalid username or password")
+	errTooManyAttempts     = apperror.New(http.StatusTooManyRequests, apperror.CodeRateLimited, "too many failed login attempts, try again later")
+	errEmailNotVerified    = apperror.Forbidden("email_not_verified", "email not verified")
+	errPermissionDenied    = apperror.Forbidden("permission_denied", "permission denied")
+	errInsufficientScope   = apperror.Forbidden("insufficient_scope", "insufficient scope")
+	errInvalidCSRF         = apperror.Forbidden("invalid_csrf_token", "invalid csrf token")
+	errSessionNotFound     = apperror.NotFound("session_not_found", "session not found")
+	errTokenStore          = apperror.Unavailable("can't connect to token store")
+	errAttemptStore        = apperror.Unavailable("can't connect to attempt store")
+
+	errMissingEmail       = apperror.BadRequest("missing_email", "email is required")
+	errTooManyResets      = apperror.New(http.StatusTooManyRequests, apperror.CodeRateLimited, "too many password reset requests, try again later")
+	errInvalidResetToken  = apperror.BadRequest("invalid_reset_token", "invalid or expired reset token")
+	errMissingVerifyToken = apperror.BadRequest("missing_token", "token is required")
+	errInvalidVerifyToken = apperror.BadRequest("invalid_verification_token", "invalid or expired verification token")
+
+	errMissingChallenge    = apperror.BadRequest("missing_challenge", "challenge_token and code or recovery_code are required")
+	errInvalidChallenge    = apperror.Unauthorized("invalid_challenge_token", "invalid or expired challenge token")
+	errMissingCode         = apperror.BadRequest("missing_code", "code is required")
+	errInvalidCode         = apperror.BadRequest("invalid_code", "invalid code")
+	errWrongCode           = apperror.Unauthorized("invalid_code", "invalid code")
+	errTwoFactorEnabled    = apperror.Conflict("two_factor_enabled", "two factor authentication is already enabled")
+	errNoPendingEnrollment = apperror.Conflict("no_pending_enrollment", "no pending two factor enrollment")
+
+	errMissingName      = apperror.BadRequest("missing_name", "name is empty")
+	errInvalidScope     = apperror.BadRequest("invalid_scope", "invalid scope")
+	errAPIKeyNotFound   = apperror.NotFound("api_key_not_found", "api key not found")
+	errMissingRedirects = apperror.BadRequest("missing_redirect_uris", "redirect_uris is empty")
+	errInvalidRedirect  = apperror.BadRequest("invalid_redirect_uri", "invalid redirect uri")
+	errClientNotFound   = apperror.NotFound("client_not_found", "client not found")
+	errUnknownClient    = apperror.BadRequest("unknown_client", "unknown client")
+	errUnregistered     = apperror.BadRequest("unregistered_redirect_uri", "redirect_uri is not registered")
+	errInvalidQuery     = apperror.BadRequest(apperror.CodeInvalidParam, "invalid query parameters")
+
+	errUnknownProvider  = apperror.NotFound("unknown_provider", "unknown provider")
+	errInvalidState     = apperror.BadRequest("invalid_state", "invalid state")
+	errProviderError    = apperror.BadRequest("provider_error", "provider returned an error")
+	errSignInFailed     = apperror.Unauthorized("sign_in_failed", "sign in with provider failed")
+	errIdentityLinked   = apperror.Conflict("identity_linked", "identity is linked to another user")
+	errIdentityNotFound = apperror.NotFound("identity_not_found", "identity not found")
+)
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// ErrInvalidJWT is returned when an access token fails verification
+var ErrInvalidJWT = errors.New("invalid access token")
+
+// AccessClaims represents claims carried by a signed access token
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// signingKey represents one key of the signer, public only keys can
+// verify tokens signed before a rotation but never sign new ones
+type signingKey struct {
+	private interface{}
+	public  interface{}
+}
+
+// Signer signs and verifies JWT access tokens.
+// Keys are identified by the kid header so they can be rotated: the
+// active key signs, every loaded key verifies.
+type Signer struct {
+	Issuer    string
+	Algorithm string
+	ActiveKID string
+	keys      map[string]signingKey
+}
+
+// LoadSigner loads every key of the algorithm from dir, the file name
+// without extension is the kid. HS256 secrets are read from <kid>.key
+// files, RS256 and EdDSA keys from PEM encoded <kid>.pem files holding
+// either a private key or, for retired keys, only the public key.
+func LoadSigner(dir, algorithm, activeKID, issuer string) (*Signer, error) {
+	s := &Signer{
+		Issuer:    issuer,
+		Algorithm: algorithm,
+		ActiveKID: activeKID,
+		keys:      map[string]signingKey{},
+	}
+
+	ext := ".pem"
+	if algorithm == HS256 {
+		ext = ".key"
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(algorithm, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		s.keys[strings.TrimSuffix(filepath.Base(file), ext)] = key
+	}
+
+	if key, ok := s.keys[activeKID]; !ok || key.private == nil {
+		return nil, fmt.Errorf("no private key found for active kid %q in %s", activeKID, dir)
+	}
+	return s, nil
+}
+
+func parseSigningKey(algorithm string, data []byte) (signingKey, error) {
+	switch algorithm {
+	case HS256:
+		secret := bytes.TrimSpace(data)
+		if len(secret) < 32 {
+			return signingKey{}, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		return signingKey{private: secret, public: secret}, nil
+	case RS256:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			return signingKey{private: private, public: &private.PublicKey}, nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return signingKey{}, err
+		}
+		return signingKey{public: public}, nil
+	case EdDSA:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			return signingKey{private: private, public: private.(crypto.Signer).Public()}, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(data)
+		if err != nil {
+			return signingKey{}, err
+		}
+		return signingKey{public: public}, nil
+	}
+	return signingKey{}, fmt.Errorf("unsupported jwt algorithm %q", algorithm)
+}
+
+func (s *Signer) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(s.Algorithm)
+}
+
+// Sign mints an access token for the session
+func (s *Signer) Sign(session Session, roles []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   session.UserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		SessionID: session.ID,
+		Roles:     roles,
+	}
+
+	token := jwt.NewWithClaims(s.method(), claims)
+	token.Header["kid"] = s.ActiveKID
+	return token.SignedString(s.keys[s.ActiveKID].private)
+}
+
+// Verify checks signature, expiry and issuer of the access token
+func (s *Signer) Verify(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{s.Algorithm}))
+	_, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+	if !claims.VerifyIssuer(s.Issuer, true) || claims.ID == "" || claims.Subject == "" {
+		return nil, ErrInvalidJWT
+	}
+	return claims, nil
+}
+
+// JWK represents one public key of the JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns public keys of the signer, HS256 secrets are never published
+func (s *Signer) JWKS() []JWK {
+	keys := []JWK{}
+	for kid, key := range s.keys {
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: RS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: EdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return keys
+}
+
+// isJWT reports whether the bearer token looks like a JWT rather than an
+// opaque session token
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// JWKS handles json web key set request
+func (h *Handler) JWKS(c *gin.Context) {
+	keys := []JWK{}
+	if h.Signer != nil {
+		keys = h.Signer.JWKS()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"keys": keys,
+	})
+}
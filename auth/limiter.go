@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Policy describes how failed logins slow down further attempts. The
+// first Threshold failures are free, every following failure doubles the
+// wait starting at BaseDelay up to MaxDelay, and after LockoutAfter
+// failures the key is locked for Lockout, zero LockoutAfter never locks
+// it. Failures are forgotten once no new one happens for Window.
+type Policy struct {
+	Threshold    int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// default policies, many users may share one IP address behind a NAT so
+// it gets more room than a single username
+var (
+	DefaultPolicy = Policy{
+		Threshold:    3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute * 5,
+		LockoutAfter: 10,
+		Lockout:      time.Minute * 15,
+		Window:       time.Hour,
+	}
+	DefaultIPPolicy = Policy{
+		Threshold:    15,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute * 5,
+		LockoutAfter: 50,
+		Lockout:      time.Minute * 15,
+		Window:       time.Hour,
+	}
+	// every password reset request counts, not only failed ones, so an
+	// address can't be flooded with reset emails
+	DefaultResetPolicy = Policy{
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour * 24,
+	}
+	DefaultResetIPPolicy = Policy{
+		Threshold: 10,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour * 24,
+	}
+)
+
+// delay returns how long to wait after the last of count failures
+func (p Policy) delay(count int) time.Duration {
+	if p.LockoutAfter > 0 && count >= p.LockoutAfter {
+		return p.Lockout
+	}
+	if count < p.Threshold {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.Threshold; i < count && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// AttemptStore counts failed login attempts per key
+type AttemptStore interface {
+	// Failures returns the number of failures of the key and when the last
+	// one happened
+	Failures(ctx context.Context, key string) (count int, last time.Time, err error)
+	// AddFailure records a failure, the count expires after window
+	AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) error
+	// Reset forgets the failures of the key
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter throttles login attempts and password reset requests per
+// username or email and per client IP
+type Limiter struct {
+	Store         AttemptStore
+	Policy        Policy
+	IPPolicy      Policy
+	ResetPolicy   Policy
+	ResetIPPolicy Policy
+}
+
+func usernameKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func resetKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func resetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+func (l *Limiter) policy() Policy {
+	if l.Policy == (Policy{}) {
+		return DefaultPolicy
+	}
+	return l.Policy
+}
+
+func (l *Limiter) ipPolicy() Policy {
+	if l.IPPolicy == (Policy{}) {
+		return DefaultIPPolicy
+	}
+	return l.IPPolicy
+}
+
+func (l *Limiter) resetPolicies(email, ip string) map[string]Policy {
+	p, ipPolicy := l.ResetPolicy, l.ResetIPPolicy
+	if p == (Policy{}) {
+		p = DefaultResetPolicy
+	}
+	if ipPolicy == (Policy{}) {
+		ipPolicy = DefaultResetIPPolicy
+	}
+	return map[string]Policy{resetKey(email): p, resetIPKey(ip): ipPolicy}
+}
+
+// RetryAfter returns how long the client must wait before trying the
+// username again, zero when the attempt is allowed
+func (l *Limiter) RetryAfter(ctx context.Context, username, ip string) (time.Duration, error) {
+	return l.retryAfter(ctx, map[string]Policy{usernameKey(username): l.policy(), ipKey(ip): l.ipPolicy()})
+}
+
+// Fail records a failed attempt on the username from the ip
+func (l *Limiter) Fail(ctx context.Context, username, ip string) error {
+	return l.add(ctx, map[string]Policy{usernameKey(username): l.policy(), ipKey(ip): l.ipPolicy()})
+}
+
+// ResetRetryAfter returns how long the client must wait before asking
+// for another reset email to the address, zero when it is allowed
+func (l *Limiter) ResetRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	return l.retryAfter(ctx, l.resetPolicies(email, ip))
+}
+
+// ResetRequested records a password reset request for the address from
+// the ip
+func (l *Limiter) ResetRequested(ctx context.Context, email, ip string) error {
+	return l.add(ctx, l.resetPolicies(email, ip))
+}
+
+func (l *Limiter) retryAfter(ctx context.Context, keys map[string]Policy) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for key, p := range keys {
+		count, last, err := l.Store.Failures(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if d := last.Add(p.delay(count)).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+func (l *Limiter) add(ctx context.Context, keys map[string]Policy) error {
+	now := time.Now()
+	for key, p := range keys {
+		if err := l.Store.AddFailure(ctx, key, now, p.Window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset clears the failures of the username, failures of the IP are kept
+// so one valid account can't be used to reset an attacker's budget
+func (l *Limiter) Reset(ctx context.Context, username string) error {
+	return l.Store.Reset(ctx, usernameKey(username))
+}
+
+// allowLogin rejects the login with 429 when the username or the client IP
+// is still backing off, it reports whether the attempt may go on
+func (h *Handler) allowLogin(c *gin.Context, username string) bool {
+	if h.Limiter == nil {
+		return true
+	}
+	wait, err := h.Limiter.RetryAfter(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		apperror.Abort(c, errAttemptStore.Wrap(err))
+		return false
+	}
+	if wait > 0 {
+		h.Audit.Record(c, audit.Event{
+			Actor:   username,
+			Action:  audit.ActionLogin,
+			Outcome: audit.Failure,
+			Detail:  "throttled",
+		})
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apperror.Abort(c, errTooManyAttempts)
+		return false
+	}
+	return true
+}
+
+// allowReset counts the password reset request for the email and
+// responds 429 when the email or the client IP asked too often. Every
+// request counts, whether the account exists or not.
+func (h *Handler) allowReset(c *gin.Context, email string) bool {
+	if h.Limiter == nil {
+		return true
+	}
+	ctx := c.Request.Context()
+	wait, err := h.Limiter.ResetRetryAfter(ctx, email, c.ClientIP())
+	if err != nil {
+		apperror.Abort(c, errAttemptStore.Wrap(err))
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apperror.Abort(c, errTooManyResets)
+		return false
+	}
+	if err := h.Limiter.ResetRequested(ctx, email, c.ClientIP()); err != nil {
+		apperror.Abort(c, errAttemptStore.Wrap(err))
+		return false
+	}
+	return true
+}
+
+// loginFailed records the failed attempt and responds 401
+func (h *Handler) loginFailed(c *gin.Context, username string) {
+	h.recordLoginFailure(c, username, "invalid credentials")
+	apperror.Abort(c, errInvalidCredentials)
+}
+
+// recordLoginFailure counts the failed attempt towards back off and
+// writes it to the audit log
+func (h *Handler) recordLoginFailure(c *gin.Context, username, reason string) {
+	if h.Limiter != nil {
+		if err := h.Limiter.Fail(c.Request.Context(), username, c.ClientIP()); err != nil {
+			logger.Extract(c).Warn("can't record failed login attempt", zap.Error(err))
+		}
+	}
+	h.Audit.Record(c, audit.Event{
+		Actor:   username,
+		Action:  audit.ActionLogin,
+		Outcome: audit.Failure,
+		Detail:  reason,
+	})
+}
+
+// Unlock handle unlock account request, it clears the failed login
+// attempts of the user
+func (h *Handler) Unlock(c *gin.Context) {
+	u, err := h.findUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if h.Limiter != nil {
+		if err := h.Limiter.Reset(c.Request.Context(), u.Username); err != nil {
+			apperror.Abort(c, errAttemptStore.Wrap(err))
+			return
+		}
+	}
+
+	h.recordChange(c, audit.ActionUnlock, audit.TargetUser, c.Param("uid"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "account unlocked",
+	})
+}
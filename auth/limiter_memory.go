@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryAttemptStore counts failed logins in process memory, for tests and
+// single node deployments
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]memoryFailures
+}
+
+type memoryFailures struct {
+	count     int
+	last      time.Time
+	expiresAt time.Time
+}
+
+// NewMemoryAttemptStore creates empty in-memory attempt store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		failures: map[string]memoryFailures{},
+	}
+}
+
+// Failures returns the number of failures of the key and when the last one happened
+func (m *MemoryAttemptStore) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.failures[key]
+	if !ok || !time.Now().Before(f.expiresAt) {
+		return 0, time.Time{}, nil
+	}
+	return f.count, f.last, nil
+}
+
+// AddFailure records a failure, the count expires after window
+func (m *MemoryAttemptStore) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for k, f := range m.failures {
+		if !now.Before(f.expiresAt) {
+			delete(m.failures, k)
+		}
+	}
+
+	f := m.failures[key]
+	f.count++
+	f.last = at
+	f.expiresAt = now.Add(window)
+	m.failures[key] = f
+	return nil
+}
+
+// Reset forgets the failures of the key
+func (m *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	return nil
+}
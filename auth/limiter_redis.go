@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisAttemptStore counts failed logins in redis so every instance sees them
+type RedisAttemptStore struct {
+	Client *redis.Client
+}
+
+func failuresKey(key string) string {
+	return "login_failures:" + key
+}
+
+// Failures returns the number of failures of the key and when the last one happened
+func (r *RedisAttemptStore) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	fields, err := r.Client.HGetAll(ctx, failuresKey(key)).Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	count, _ := strconv.Atoi(fields["count"])
+	last, _ := time.Parse(time.RFC3339Nano, fields["last"])
+	return count, last, nil
+}
+
+// AddFailure records a failure, the count expires after window
+func (r *RedisAttemptStore) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) error {
+	pipe := r.Client.TxPipeline()
+	pipe.HIncrBy(ctx, failuresKey(key), "count", 1)
+	pipe.HSet(ctx, failuresKey(key), "last", at.UTC().Format(time.RFC3339Nano))
+	pipe.Expire(ctx, failuresKey(key), window)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Reset forgets the failures of the key
+func (r *RedisAttemptStore) Reset(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, failuresKey(key)).Err()
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// prefixes of credentials issued to third-party clients
+const (
+	oauthAccessPrefix  = "sgo_"
+	oauthRefreshPrefix = "sgr_"
+	oauthClientPrefix  = "sgc_"
+)
+
+// OAuthClient is a third-party application registered by a user that
+// may act on behalf of users who consent to it. Public clients such as
+// mobile apps have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	OwnerID      uint      `gorm:"index" json:"owner_id"`
+	ClientID     string    `gorm:"size:64;uniqueIndex" json:"client_id"`
+	SecretHash   string    `gorm:"size:64" json:"-"`
+	Name         string    `gorm:"size:100" json:"name"`
+	RedirectURIs string    `gorm:"size:1000" json:"-"`
+	Scopes       string    `gorm:"size:255" json:"-"`
+}
+
+// OAuthToken is an access token issued to a client with its refresh
+// token, only hashes are stored
+type OAuthToken struct {
+	ID               uint `gorm:"primarykey"`
+	CreatedAt        time.Time
+	ClientID         string `gorm:"size:64;index"`
+	UserID           uint   `gorm:"index"`
+	Scopes           string `gorm:"size:255"`
+	AccessHash       string `gorm:"size:64;uniqueIndex"`
+	AccessExpiresAt  time.Time
+	RefreshHash      string `gorm:"size:64;uniqueIndex"`
+	RefreshExpiresAt time.Time
+}
+
+// OAuthClientRequest represents register client request body
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+// OAuthClientResponse represents a client, ClientSecret is only set on
+// registration
+type OAuthClientResponse struct {
+	OAuthClient
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+}
+
+func (o OAuthClient) response() OAuthClientResponse {
+	return OAuthClientResponse{
+		OAuthClient:  o,
+		RedirectURIs: splitList(o.RedirectURIs),
+		Scopes:       splitList(o.Scopes),
+		Public:       o.SecretHash == "",
+	}
+}
+
+// allowsRedirect reports whether uri exactly matches a registered one
+func (o OAuthClient) allowsRedirect(uri string) bool {
+	for _, r := range splitList(o.RedirectURIs) {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsScopes reports whether every scope was registered by the client
+func (o OAuthClient) allowsScopes(scopes []string) bool {
+	allowed := splitList(o.Scopes)
+	for _, s := range scopes {
+		ok := false
+		for _, a := range allowed {
+			if s == a {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList splits space separated list as used by the scope parameter
+func splitList(s string) []string {
+	return strings.Fields(s)
+}
+
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func isOAuthToken(token string) bool {
+	return strings.HasPrefix(token, oauthAccessPrefix)
+}
+
+// lookupOAuthToken resolves an access token issued to a client, the role
+// is read from the database so role changes apply at once
+func (h *Handler) lookupOAuthToken(ctx context.Context, token string) (Session, OAuthToken, error) {
+	db := h.DB.WithContext(ctx)
+
+	t := OAuthToken{}
+	result := db.Where("access_hash = ? AND access_expires_at > ?", hashToken(token), time.Now().UTC()).Limit(1).Find(&t)
+	if result.Error != nil {
+		return Session{}, t, result.Error
+	} else if result.RowsAffected == 0 {
+		return Session{}, t, ErrSessionNotFound
+	}
+	u := user.User{}
+	if result := db.Select("id", "role").Limit(1).Find(&u, t.UserID); result.Error != nil {
+		return Session{}, t, result.Error
+	} else if result.RowsAffected == 0 {
+		return Session{}, t, ErrSessionNotFound
+	}
+	return Session{UserID: strconv.Itoa(int(u.ID)), Role: u.Role}, t, nil
+}
+
+// ListOAuthClients handle list clients request
+func (h *Handler) ListOAuthClients(c *gin.Context) {
+	clients := []OAuthClient{}
+	if result := h.DB.Where("owner_id = ?", c.Param("uid")).Order("id").Find(&clients); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	res := make([]OAuthClientResponse, len(clients))
+	for i, o := range clients {
+		res[i] = o.response()
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// AddOAuthClient handle register client request, the secret of
+// confidential clients is only returned in this response
+func (h *Handler) AddOAuthClient(c *gin.Context) {
+	req := OAuthClientRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.Name == "" {
+		apperror.Abort(c, errMissingName)
+		return
+	}
+	if len(req.RedirectURIs) == 0 {
+		apperror.Abort(c, errMissingRedirects)
+		return
+	}
+	for _, r := range req.RedirectURIs {
+		u, err := url.Parse(r)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(r, " ") {
+			apperror.Abort(c, errInvalidRedirect.With("redirect_uri", r))
+			return
+		}
+	}
+	for _, s := range req.Scopes {
+		if !rbac.ValidScope(s) {
+			apperror.Abort(c, errInvalidScope.With("scope", s).With("valid_scopes", rbac.Scopes()))
+			return
+		}
+	}
+
+	owner, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, user.ErrInvalidUserID)
+		return
+	}
+	o := OAuthClient{
+		OwnerID:      uint(owner),
+		ClientID:     oauthClientPrefix + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		Scopes:       strings.Join(req.Scopes, " "),
+	}
+	secret := ""
+	if !req.Public {
+		secret, err = randomToken("")
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		o.SecretHash = hashToken(secret)
+	}
+	if result := h.DB.Create(&o); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+
+	h.recordChange(c, audit.ActionOAuthClientCreate, audit.TargetOAuthClient, o.ClientID)
+	res := o.response()
+	res.ClientSecret = secret
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteOAuthClient handle delete client request, every token issued to
+// the client stops working
+func (h *Handler) DeleteOAuthClient(c *gin.Context) {
+	o := OAuthClient{}
+	if result := h.DB.Where("id = ? AND owner_id = ?", c.Param("cid"), c.Param("uid")).Limit(1).Find(&o); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	} else if result.RowsAffected == 0 {
+		apperror.Abort(c, errClientNotFound)
+		return
+	}
+
+	if err := h.DB.Where("client_id = ?", o.ClientID).Delete(&OAuthToken{}).Error; err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := h.DB.Delete(&o).Error; err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.recordChange(c, audit.ActionOAuthClientDelete, audit.TargetOAuthClient, o.ClientID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "client deleted",
+	})
+}
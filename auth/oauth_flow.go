@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// oauthCodeTTL is how long an authorization code can be exchanged
+const oauthCodeTTL = time.Minute * 2
+
+// AuthorizeRequest represents parameters of the authorization endpoint,
+// Approve is only read when the user answers the consent screen
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Approve             bool   `form:"approve" json:"approve"`
+}
+
+// ConsentResponse represents what the user is asked to approve
+type ConsentResponse struct {
+	ClientID    string   `json:"client_id"`
+	Name        string   `json:"name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+	State       string   `json:"state"`
+}
+
+// OAuthTokenResponse represents token endpoint response body
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthCode is kept server side until the client exchanges the code
+type oauthCode struct {
+	ClientID    string `json:"client_id"`
+	UserID      string `json:"uid"`
+	RedirectURI string `json:"redirect_uri"`
+	Scopes      string `json:"scopes"`
+	Challenge   string `json:"challenge"`
+}
+
+// oauthError writes error response of the token, introspection and
+// revocation endpoints as defined by RFC 6749
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// oauthServerError logs the cause and writes a server_error response,
+// the cause isn't sent as it may hold database details
+func oauthServerError(c *gin.Context, err error) {
+	logger.Extract(c).Error("oauth request failed", zap.Error(err))
+	oauthError(c, http.StatusInternalServerError, "server_error", "internal server error")
+}
+
+// redirectWith returns the redirect uri with params added to its query
+func redirectWith(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// consent validates an authorization request. Errors about the client or
+// redirect uri are never sent to the redirect uri since it can't be
+// trusted, the others are returned with the redirect the client expects.
+func (h *Handler) consent(c *gin.Context, req AuthorizeRequest) (OAuthClient, []string, bool) {
+	o := OAuthClient{}
+	if result := h.DB.Where("client_id = ?", req.ClientID).Limit(1).Find(&o); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return o, nil, false
+	} else if result.RowsAffected == 0 {
+		apperror.Abort(c, errUnknownClient)
+		return o, nil, false
+	}
+	if !o.allowsRedirect(req.RedirectURI) {
+		apperror.Abort(c, errUnregistered)
+		return o, nil, false
+	}
+
+	reject := func(code, description string) {
+		apperror.Abort(c, apperror.BadRequest(code, description).With("redirect", redirectWith(req.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		})))
+	}
+	if req.ResponseType != "code" {
+		reject("unsupported_response_type", "only response_type code is supported")
+		return o, nil, false
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		reject("invalid_request", "code_challenge with code_challenge_method S256 is required")
+		return o, nil, false
+	}
+	scopes := splitList(req.Scope)
+	if len(scopes) == 0 || !o.allowsScopes(scopes) {
+		reject("invalid_scope", "scope must be a subset of "+o.Scopes)
+		return o, nil, false
+	}
+	for _, s := range scopes {
+		if !rbac.ValidScope(s) {
+			reject("invalid_scope", "invalid scope "+s)
+			return o, nil, false
+		}
+	}
+	return o, scopes, true
+}
+
+// Consent handle authorization request, it returns the client and scopes
+// the user is asked to approve
+func (h *Handler) Consent(c *gin.Context) {
+	req := AuthorizeRequest{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apperror.Abort(c, errInvalidQuery.Wrap(err))
+		return
+	}
+	o, scopes, ok := h.consent(c, req)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, ConsentResponse{
+		ClientID:    o.ClientID,
+		Name:        o.Name,
+		RedirectURI: req.RedirectURI,
+		Scopes:      scopes,
+		State:       req.State,
+	})
+}
+
+// Approve handle consent answer, it returns the redirect back to the
+// client with an authorization code or access_denied
+func (h *Handler) Approve(c *gin.Context) {
+	req := AuthorizeRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	o, scopes, ok := h.consent(c, req)
+	if !ok {
+		return
+	}
+	if !req.Approve {
+		c.JSON(http.StatusOK, gin.H{
+			"redirect": redirectWith(req.RedirectURI, url.Values{
+				"error": {"access_denied"},
+				"state": {req.State},
+			}),
+		})
+		return
+	}
+
+	code, err := randomToken("")
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	value, err := json.Marshal(oauthCode{
+		ClientID:    o.ClientID,
+		UserID:      c.GetString("uid"),
+		RedirectURI: req.RedirectURI,
+		Scopes:      strings.Join(scopes, " "),
+		Challenge:   req.CodeChallenge,
+	})
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := h.Tickets.Put(c.Request.Context(), OAuthCodeTicket, code, string(value), oauthCodeTTL); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"redirect": redirectWith(req.RedirectURI, url.Values{
+			"code":  {code},
+			"state": {req.State},
+		}),
+	})
+}
+
+// authenticateClient reads client credentials from basic auth or the
+// form. Public clients are identified by client_id alone.
+func (h *Handler) authenticateClient(c *gin.Context) (OAuthClient, bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// credentials are form encoded before basic encoding
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	o := OAuthClient{}
+	if id == "" {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return o, false
+	}
+	if result := h.DB.Where("client_id = ?", id).Limit(1).Find(&o); result.Error != nil {
+		oauthServerError(c, result.Error)
+		return o, false
+	} else if result.RowsAffected == 0 {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return o, false
+	}
+	if o.SecretHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(o.SecretHash)) != 1 {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return o, false
+	}
+	return o, true
+}
+
+// IssueOAuthToken handle token request of the authorization_code and
+// refresh_token grants, refresh tokens are rotated on use
+func (h *Handler) IssueOAuthToken(c *gin.Context) {
+	o, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		h.exchangeCode(c, o)
+	case "refresh_token":
+		h.refreshOAuthToken(c, o)
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+func (h *Handler) exchangeCode(c *gin.Context, o OAuthClient) {
+	value, err := h.Tickets.Take(c.Request.Context(), OAuthCodeTicket, c.PostForm("code"))
+	if err == ErrTicketNotFound {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid code")
+		return
+	} else if err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	code := oauthCode{}
+	if err := json.Unmarshal([]byte(value), &code); err != nil || code.ClientID != o.ClientID {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid code")
+		return
+	}
+	if c.PostForm("redirect_uri") != code.RedirectURI {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+	verifier := c.PostForm("code_verifier")
+	if verifier == "" || subtle.ConstantTimeCompare([]byte(oidc.Challenge(verifier)), []byte(code.Challenge)) != 1 {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+		return
+	}
+
+	uid, err := strconv.Atoi(code.UserID)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid code")
+		return
+	}
+	t := OAuthToken{ClientID: o.ClientID, UserID: uint(uid), Scopes: code.Scopes}
+	access, refresh, err := h.rotateOAuthToken(&t)
+	if err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	if err := h.DB.Create(&t).Error; err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	h.writeOAuthToken(c, t, access, refresh)
+}
+
+func (h *Handler) refreshOAuthToken(c *gin.Context, o OAuthClient) {
+	hash := hashToken(c.PostForm("refresh_token"))
+	t := OAuthToken{}
+	if result := h.DB.Where("refresh_hash = ? AND client_id = ? AND refresh_expires_at > ?", hash, o.ClientID, time.Now().UTC()).Limit(1).Find(&t); result.Error != nil {
+		oauthServerError(c, result.Error)
+		return
+	} else if result.RowsAffected == 0 {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid refresh_token")
+		return
+	}
+
+	access, refresh, err := h.rotateOAuthToken(&t)
+	if err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	// the old refresh token is matched again so only one of concurrent
+	// refreshes wins
+	result := h.DB.Model(&OAuthToken{}).Where("id = ? AND refresh_hash = ?", t.ID, hash).Updates(map[string]interface{}{
+		"access_hash":        t.AccessHash,
+		"access_expires_at":  t.AccessExpiresAt,
+		"refresh_hash":       t.RefreshHash,
+		"refresh_expires_at": t.RefreshExpiresAt,
+	})
+	if result.Error != nil {
+		oauthServerError(c, result.Error)
+		return
+	} else if result.RowsAffected == 0 {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid refresh_token")
+		return
+	}
+	h.writeOAuthToken(c, t, access, refresh)
+}
+
+// rotateOAuthToken sets hashes and expiry of new access and refresh
+// tokens on t and returns the tokens
+func (h *Handler) rotateOAuthToken(t *OAuthToken) (string, string, error) {
+	access, err := randomToken(oauthAccessPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := randomToken(oauthRefreshPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now().UTC()
+	t.AccessHash = hashToken(access)
+	t.AccessExpiresAt = now.Add(h.accessTTL())
+	t.RefreshHash = hashToken(refresh)
+	t.RefreshExpiresAt = now.Add(h.refreshTTL())
+	return access, refresh, nil
+}
+
+func (h *Handler) writeOAuthToken(c *gin.Context, t OAuthToken, access, refresh string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, OAuthTokenResponse{
+		AccessToken:  access,
+		TokenType:    tokenType,
+		ExpiresIn:    int(h.accessTTL().Seconds()),
+		RefreshToken: refresh,
+		Scope:        t.Scopes,
+	})
+}
+
+// findOAuthToken returns the token of the client matching an access or
+// refresh token
+func (h *Handler) findOAuthToken(o OAuthClient, token string) (OAuthToken, bool, error) {
+	t := OAuthToken{}
+	hash := hashToken(token)
+	result := h.DB.Where("client_id = ? AND (access_hash = ? OR refresh_hash = ?)", o.ClientID, hash, hash).Limit(1).Find(&t)
+	return t, result.RowsAffected == 1, result.Error
+}
+
+// Introspect handle token introspection request of RFC 7662, clients can
+// only introspect tokens issued to themselves
+func (h *Handler) Introspect(c *gin.Context) {
+	o, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if o.SecretHash == "" {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "public clients can't introspect tokens")
+		return
+	}
+
+	token := c.PostForm("token")
+	t, found, err := h.findOAuthToken(o, token)
+	if err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	now := time.Now().UTC()
+	expiresAt := t.AccessExpiresAt
+	if t.RefreshHash == hashToken(token) {
+		expiresAt = t.RefreshExpiresAt
+	}
+	c.Header("Cache-Control", "no-store")
+	if !found || !expiresAt.After(now) {
+		c.JSON(http.StatusOK, gin.H{
+			"active": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"scope":      t.Scopes,
+		"client_id":  t.ClientID,
+		"sub":        strconv.Itoa(int(t.UserID)),
+		"token_type": tokenType,
+		"exp":        expiresAt.Unix(),
+	})
+}
+
+// RevokeOAuthToken handle token revocation request of RFC 7009, revoking
+// either token of a grant revokes both. Unknown tokens are not an error.
+func (h *Handler) RevokeOAuthToken(c *gin.Context) {
+	o, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	hash := hashToken(c.PostForm("token"))
+	if err := h.DB.Where("client_id = ? AND (access_hash = ? OR refresh_hash = ?)", o.ClientID, hash, hash).Delete(&OAuthToken{}).Error; err != nil {
+		oauthServerError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
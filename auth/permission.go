@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission returns middleware that only lets through users whose
+// role is granted the permission, it must run after Authorize
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rbac.Can(c.GetString("role"), permission) {
+			apperror.Abort(c, errPermissionDenied)
+			return
+		}
+	}
+}
+
+// OwnerOr returns middleware that lets through the user named by the uid
+// route parameter, or anyone whose role is granted the permission.
+// Admins pass every owner check. It must run after Authorize.
+func OwnerOr(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("uid") == c.Param("uid") {
+			return
+		}
+		if !rbac.Can(c.GetString("role"), permission) {
+			apperror.Abort(c, errPermissionDenied)
+			return
+		}
+	}
+}
+
+// Owner returns middleware that only lets through the user named by the
+// uid route parameter, for actions nobody may take on behalf of another
+// user. It must run after Authorize.
+func Owner(c *gin.Context) {
+	if c.GetString("uid") != c.Param("uid") {
+		apperror.Abort(c, errPermissionDenied)
+		return
+	}
+}
+
+// RequireScope returns middleware that only lets through requests whose
+// credential was granted the scope. Login sessions carry no scopes and
+// act with every permission of their user. It must run after Authorize.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := c.Get("scopes")
+		if !ok {
+			return
+		}
+		if hasScope(granted.([]string), scope) {
+			return
+		}
+		apperror.Abort(c, errInsufficientScope)
+	}
+}
+
+func hasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/mail"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const defaultResetTTL = time.Hour
+
+// ForgotPasswordRequest represents forgot password request body
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents reset password request body
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+func (h *Handler) resetTTL() time.Duration {
+	if h.ResetTTL == 0 {
+		return defaultResetTTL
+	}
+	return h.ResetTTL
+}
+
+// link returns absolute url of path on this server
+func (h *Handler) link(path string) string {
+	return strings.TrimRight(h.BaseURL, "/") + path
+}
+
+// ForgotPassword handle forgot password request, it mails a single-use
+// reset token to the account with the email. The response is the same
+// whether the account exists or not, and requests are throttled per
+// email and per client IP.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	req := ForgotPasswordRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.Email == "" {
+		apperror.Abort(c, errMissingEmail)
+		return
+	}
+	if !h.allowReset(c, req.Email) {
+		return
+	}
+
+	l := logger.Extract(c)
+	res := gin.H{
+		"message": "if the account exists, a reset token has been sent",
+	}
+
+	u, err := h.Users.FindByEmail(c.Request.Context(), req.Email)
+	if errors.Is(err, user.ErrUserNotFound) {
+		c.JSON(http.StatusAccepted, res)
+		return
+	} else if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	token := uuid.New().String()
+	if err := h.Tickets.Put(c.Request.Context(), PasswordResetTicket, token, strconv.Itoa(int(u.ID)), h.resetTTL()); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+
+	err = h.Mailer.Send(c.Request.Context(), mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this token to reset your password within %s:\n\n%s\n\nor send it to %s\n\nIgnore this email if you didn't ask for it.\n",
+			u.Name, h.resetTTL(), token, h.link("/password/reset")),
+	})
+	if err != nil {
+		// don't tell the client, it would reveal the account exists
+		l.Error("can't send password reset email", zap.Uint("uid", u.ID), zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+// ResetPassword handle reset password request, it sets the new password
+// and revokes every session, API key and OAuth token of the user
+func (h *Handler) ResetPassword(c *gin.Context) {
+	req := ResetPasswordRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	uid, err := h.Tickets.Take(c.Request.Context(), PasswordResetTicket, req.Token)
+	if err == ErrTicketNotFound {
+		apperror.Abort(c, errInvalidResetToken)
+		return
+	} else if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+
+	u, err := h.findUser(c.Request.Context(), uid)
+	if errors.Is(err, user.ErrUserNotFound) {
+		apperror.Abort(c, errInvalidResetToken)
+		return
+	} else if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	hash, err := h.Hasher.Hash(req.Password)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	u.Password = hash
+	if err := h.Users.Update(c.Request.Context(), &u, "Password"); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.RevokeCredentials(c.Request.Context(), u.ID); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	// proving access to the mailbox also lifts a lockout
+	if h.Limiter != nil {
+		if err := h.Limiter.Reset(c.Request.Context(), u.Username); err != nil {
+			logger.Extract(c).Warn("can't reset failed login attempts", zap.Uint("uid", u.ID), zap.Error(err))
+		}
+	}
+
+	// the user isn't signed in but proved who they are with the ticket
+	h.Audit.Record(c, audit.Event{
+		ActorID:    strconv.Itoa(int(u.ID)),
+		Actor:      u.Username,
+		Action:     audit.ActionPasswordReset,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(int(u.ID)),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password has been reset",
+	})
+}
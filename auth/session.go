@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// default token lifetimes
+const (
+	defaultAccessTTL  = time.Minute * 15
+	defaultRefreshTTL = time.Hour * 24 * 30
+)
+
+// touchInterval throttles how often activity extends a session, so
+// requests in quick succession don't each write to the store
+const touchInterval = time.Minute
+
+// sessionExpiresHeader tells clients when their session expires unless
+// they stay active
+const sessionExpiresHeader = "X-Session-Expires-At"
+
+// Session represents an active login of a user on one device.
+// Every access and refresh token issued from one login belongs to the
+// same session, revoking the session revokes all of them.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+func (h *Handler) accessTTL() time.Duration {
+	if h.AccessTTL == 0 {
+		return defaultAccessTTL
+	}
+	return h.AccessTTL
+}
+
+func (h *Handler) refreshTTL() time.Duration {
+	if h.RefreshTTL == 0 {
+		return defaultRefreshTTL
+	}
+	return h.RefreshTTL
+}
+
+// sessionExpiry returns when the session expires if it was last active at
+// now, the idle timeout slides with activity up to the absolute lifetime
+func (h *Handler) sessionExpiry(s Session, now time.Time) time.Time {
+	idle := h.SessionIdle
+	if idle == 0 {
+		idle = h.refreshTTL()
+	}
+	expiresAt := now.Add(idle)
+	if h.SessionLifetime > 0 {
+		if end := s.CreatedAt.Add(h.SessionLifetime); end.Before(expiresAt) {
+			expiresAt = end
+		}
+	}
+	return expiresAt
+}
+
+// touchSession extends the session on activity at most once per
+// touchInterval and returns its expiry
+func (h *Handler) touchSession(ctx context.Context, s Session, now time.Time) (time.Time, error) {
+	if now.Sub(s.LastSeen) < touchInterval && !s.ExpiresAt.IsZero() {
+		return s.ExpiresAt, nil
+	}
+	expiresAt := h.sessionExpiry(s, now)
+	if err := h.Store.Touch(ctx, s.ID, now, expiresAt); err != nil {
+		return s.ExpiresAt, err
+	}
+	return expiresAt, nil
+}
+
+func setSessionExpires(c *gin.Context, expiresAt time.Time) {
+	c.Header(sessionExpiresHeader, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// newTokens generates tokens for a session, signed access tokens are
+// minted by signAccess once the session is known
+func (h *Handler) newTokens() Tokens {
+	t := Tokens{
+		AccessTTL:    h.accessTTL(),
+		RefreshToken: uuid.New().String(),
+		RefreshTTL:   h.refreshTTL(),
+	}
+	if h.Signer == nil {
+		t.AccessToken = uuid.New().String()
+	}
+	return t
+}
+
+// signAccess mints the JWT access token of the session in JWT mode
+func (h *Handler) signAccess(s Session, t *Tokens) error {
+	if h.Signer == nil {
+		return nil
+	}
+	token, err := h.Signer.Sign(s, []string{s.Role}, t.AccessTTL)
+	if err != nil {
+		return err
+	}
+	t.AccessToken = token
+	return nil
+}
+
+// createSession starts a new session for the user and issues its first tokens,
+// the role is captured so authorization doesn't need the database
+func (h *Handler) createSession(c *gin.Context, u user.User) (Tokens, error) {
+	now := time.Now().UTC()
+	s := Session{
+		ID:        uuid.New().String(),
+		UserID:    strconv.Itoa(int(u.ID)),
+		Role:      u.Role,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	s.ExpiresAt = h.sessionExpiry(s, now)
+	setSessionExpires(c, s.ExpiresAt)
+	tokens := h.newTokens()
+	if err := h.Store.Issue(c.Request.Context(), s, tokens); err != nil {
+		return tokens, errTokenStore.Wrap(err)
+	}
+	return tokens, h.signAccess(s, &tokens)
+}
+
+// revokeSession deletes the session, in JWT mode its id is denied until
+// the access tokens already handed out expire
+func (h *Handler) revokeSession(ctx context.Context, uid string, sid string) error {
+	if h.Signer != nil {
+		if err := h.Store.Deny(ctx, h.accessTTL(), sid); err != nil {
+			return err
+		}
+	}
+	return h.Store.Revoke(ctx, uid, sid)
+}
+
+// RevokeAll deletes every session of the user
+func (h *Handler) RevokeAll(ctx context.Context, uid uint) error {
+	id := strconv.Itoa(int(uid))
+	if h.Signer != nil {
+		sessions, err := h.Store.ListByUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		sids := make([]string, 0, len(sessions))
+		for _, s := range sessions {
+			sids = append(sids, s.ID)
+		}
+		if len(sids) > 0 {
+			if err := h.Store.Deny(ctx, h.accessTTL(), sids...); err != nil {
+				return err
+			}
+		}
+	}
+	return h.Store.RevokeAll(ctx, id)
+}
+
+// RevokeCredentials deletes every session, API key and OAuth access token
+// of the user, for when the password changes or the account is deleted
+func (h *Handler) RevokeCredentials(ctx context.Context, uid uint) error {
+	if err := h.RevokeAll(ctx, uid); err != nil {
+		return err
+	}
+	if h.DB == nil {
+		return nil
+	}
+	return h.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", uid).Delete(&APIKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", uid).Delete(&OAuthToken{}).Error
+	})
+}
+
+// LogOut revokes the session of the token used in the request
+func (h *Handler) LogOut(c *gin.Context) {
+	token, cookie, ok := h.sessionToken(c)
+	if !ok {
+		apperror.Abort(c, errMissingToken)
+		return
+	}
+	if cookie && !validCSRF(c) {
+		apperror.Abort(c, errInvalidCSRF)
+		return
+	}
+
+	s, claims, err := h.authenticate(c.Request.Context(), token)
+	if err != nil {
+		if err == ErrSessionNotFound || err == ErrInvalidJWT {
+			apperror.Abort(c, errInvalidToken)
+		} else {
+			apperror.Abort(c, errTokenStore.Wrap(err))
+		}
+		return
+	}
+
+	if claims != nil {
+		if err := h.Store.Deny(c.Request.Context(), h.accessTTL(), claims.ID); err != nil {
+			apperror.Abort(c, errTokenStore.Wrap(err))
+			return
+		}
+	}
+	if err := h.revokeSession(c.Request.Context(), s.UserID, s.ID); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	if cookie {
+		h.clearSessionCookies(c)
+	}
+	h.Audit.Record(c, audit.Event{ActorID: s.UserID, Action: audit.ActionLogout, TargetType: audit.TargetSession, TargetID: s.ID})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out",
+	})
+}
+
+// Refresh handles refresh token request, replaying an already rotated
+// refresh token revokes the whole session. Browser sessions send the
+// refresh cookie instead and get new cookies back.
+func (h *Handler) Refresh(c *gin.Context) {
+	refreshToken := c.Request.FormValue("refresh_token")
+	cookie := false
+	if refreshToken == "" && h.CookieSessions {
+		refreshToken, _ = c.Cookie(refreshCookie)
+		cookie = refreshToken != ""
+		if cookie && !validCSRF(c) {
+			apperror.Abort(c, errInvalidCSRF)
+			return
+		}
+	}
+	if refreshToken == "" {
+		apperror.Abort(c, errMissingRefreshToken)
+		return
+	}
+
+	tokens := h.newTokens()
+	s, err := h.Store.Rotate(c.Request.Context(), refreshToken, tokens)
+	if err != nil {
+		switch err {
+		case ErrSessionNotFound:
+			apperror.Abort(c, errInvalidRefreshToken)
+		case ErrRefreshReused:
+			// the store already dropped the session, signed tokens still need denying
+			if err := h.revokeSession(c.Request.Context(), s.UserID, s.ID); err != nil {
+				logger.Extract(c).Error("can't revoke reused session", zap.Error(err))
+			}
+			apperror.Abort(c, errRefreshReused)
+		default:
+			apperror.Abort(c, errTokenStore.Wrap(err))
+		}
+		return
+	}
+	// refreshing counts as activity, it is the only way sessions of
+	// signed access tokens are extended
+	expiresAt, err := h.touchSession(c.Request.Context(), s, time.Now().UTC())
+	if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	setSessionExpires(c, expiresAt)
+	if err := h.signAccess(s, &tokens); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if cookie {
+		if err := h.setSessionCookies(c, tokens); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, newUserAuthResponse(tokens))
+}
+
+// ListSessions handles list sessions request
+func (h *Handler) ListSessions(c *gin.Context) {
+	sessions, err := h.Store.ListByUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteSession handles revoke one session request
+func (h *Handler) DeleteSession(c *gin.Context) {
+	uid := c.Param("uid")
+
+	s, err := h.Store.Get(c.Request.Context(), c.Param("sid"))
+	if err != nil && err != ErrSessionNotFound {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	// sessions of other users are reported as missing
+	if err == ErrSessionNotFound || s.UserID != uid {
+		apperror.Abort(c, errSessionNotFound)
+		return
+	}
+
+	if err := h.revokeSession(c.Request.Context(), uid, s.ID); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	h.recordChange(c, audit.ActionSessionRevoke, audit.TargetSession, s.ID)
+	c.JSON(http.StatusOK, s)
+}
+
+// RevokeAllSessions handles revoke all sessions request
+func (h *Handler) RevokeAllSessions(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, user.ErrInvalidUserID)
+		return
+	}
+
+	if err := h.RevokeAll(c.Request.Context(), uint(uid)); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	h.recordChange(c, audit.ActionSessionRevoke, audit.TargetUser, c.Param("uid"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "all sessions revoked",
+	})
+}
@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/database"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	oidcStateTTL    = time.Minute * 10
+	oidcStateCookie = "oidc_state"
+)
+
+// Identity links an account of an external OpenID Connect provider to a user
+type Identity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Provider  string    `gorm:"size:50;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email     string    `json:"email"`
+}
+
+// oidcState is kept server side between redirecting to the provider and
+// its callback
+type oidcState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUID is set when an authenticated user links a new identity
+	LinkUID string `json:"link_uid,omitempty"`
+}
+
+func (h *Handler) provider(c *gin.Context) (*oidc.Provider, bool) {
+	p, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		apperror.Abort(c, errUnknownProvider)
+	}
+	return p, ok
+}
+
+// startOIDC stores the flow state and returns the provider url to
+// redirect the user to. The state is also bound to the browser with a
+// cookie so a callback can't be replayed in another browser.
+func (h *Handler) startOIDC(c *gin.Context, p *oidc.Provider, linkUID string) (string, error) {
+	state, err := oidc.NewState()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(oidcState{Provider: p.Name, Nonce: nonce, Verifier: verifier, LinkUID: linkUID})
+	if err != nil {
+		return "", err
+	}
+	if err := h.Tickets.Put(c.Request.Context(), OIDCStateTicket, state, string(value), oidcStateTTL); err != nil {
+		return "", err
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/oidc/"+p.Name, "", h.secureCookies(), true)
+	return p.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// OIDCLogin handle social login request, it redirects to the provider
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	u, err := h.startOIDC(c, p, "")
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, u)
+}
+
+// LinkIdentity handle link identity request, it returns the provider url
+// the user has to visit, the identity is linked on callback
+func (h *Handler) LinkIdentity(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	u, err := h.startOIDC(c, p, c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url": u,
+	})
+}
+
+// OIDCCallback handle provider callback, it signs in the user of the
+// identity, provisioning a new account on first sign in, or links the
+// identity when the flow was started by LinkIdentity
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		apperror.Abort(c, errProviderError.With("provider_error", e))
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/oidc/"+p.Name, "", h.secureCookies(), true)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		apperror.Abort(c, errInvalidState)
+		return
+	}
+
+	value, err := h.Tickets.Take(c.Request.Context(), OIDCStateTicket, state)
+	if err == ErrTicketNotFound {
+		apperror.Abort(c, errInvalidState)
+		return
+	} else if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	s := oidcState{}
+	if err := json.Unmarshal([]byte(value), &s); err != nil || s.Provider != p.Name {
+		apperror.Abort(c, errInvalidState)
+		return
+	}
+
+	claims, err := p.Exchange(c.Request.Context(), c.Query("code"), s.Verifier, s.Nonce)
+	if err != nil {
+		logger.Extract(c).Warn("oidc exchange failed", zap.String("provider", p.Name), zap.Error(err))
+		apperror.Abort(c, errSignInFailed)
+		return
+	}
+
+	identity := Identity{}
+	result := h.DB.Where("provider = ? AND subject = ?", p.Name, claims.Subject).Limit(1).Find(&identity)
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	linked := result.RowsAffected == 1
+
+	if s.LinkUID != "" {
+		h.linkIdentity(c, s.LinkUID, p.Name, claims, identity, linked)
+		return
+	}
+
+	u := user.User{}
+	if linked {
+		u, err = h.Users.Get(c.Request.Context(), identity.UserID)
+		if errors.Is(err, user.ErrUserNotFound) {
+			apperror.Abort(c, errSignInFailed)
+			return
+		} else if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	} else {
+		u, err = h.provision(c, p.Name, claims)
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	}
+
+	h.firstFactorPassed(c, u)
+}
+
+func (h *Handler) linkIdentity(c *gin.Context, uid, provider string, claims *oidc.Claims, identity Identity, linked bool) {
+	if linked {
+		if strconv.Itoa(int(identity.UserID)) != uid {
+			apperror.Abort(c, errIdentityLinked)
+			return
+		}
+		c.JSON(http.StatusOK, identity)
+		return
+	}
+
+	id, err := strconv.Atoi(uid)
+	if err != nil {
+		apperror.Abort(c, user.ErrInvalidUserID)
+		return
+	}
+	identity = Identity{UserID: uint(id), Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	if result := h.DB.Create(&identity); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, identity)
+}
+
+// provision creates the account of an identity signing in for the first
+// time. Existing accounts with the same email are never merged, that
+// would let whoever controls the provider account take them over, users
+// link identities explicitly instead.
+func (h *Handler) provision(c *gin.Context, provider string, claims *oidc.Claims) (user.User, error) {
+	username, err := h.availableUsername(c.Request.Context(), usernameCandidate(provider, claims))
+	if err != nil {
+		return user.User{}, err
+	}
+	// the account can only sign in through the provider until a password
+	// is set with a password reset
+	hash, err := h.Hasher.Hash(uuid.New().String())
+	if err != nil {
+		return user.User{}, err
+	}
+
+	u := user.User{
+		Username: username,
+		Password: hash,
+		Name:     claims.Name,
+		Email:    claims.Email,
+		Role:     rbac.RoleUser,
+	}
+	if claims.EmailVerified {
+		now := time.Now().UTC()
+		u.VerifiedAt = &now
+	}
+
+	ctx := c.Request.Context()
+	err = h.Users.WithinTx(ctx, func(ctx context.Context) error {
+		if err := h.Users.Create(ctx, &u); err != nil {
+			return err
+		}
+		return database.Conn(ctx, h.DB).Create(&Identity{UserID: u.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email}).Error
+	})
+	if err != nil {
+		return user.User{}, err
+	}
+	logger.Extract(c).Info("provisioned user from identity", zap.Uint("uid", u.ID), zap.String("provider", provider))
+	h.Audit.Record(c, audit.Event{
+		ActorID:    strconv.Itoa(int(u.ID)),
+		Actor:      u.Username,
+		Action:     audit.ActionUserCreate,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(int(u.ID)),
+		Detail:     "provisioned by " + provider,
+	})
+	return u, nil
+}
+
+var usernameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func usernameCandidate(provider string, claims *oidc.Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	name = usernameInvalid.ReplaceAllString(name, "")
+	if name == "" {
+		name = provider + "-user"
+	}
+	// leave room for the suffix of availableUsername
+	if max := validation.UsernameMax - 4; len(name) > max {
+		name = name[:max]
+	}
+	for len(name) < validation.UsernameMin {
+		name += "_"
+	}
+	return name
+}
+
+// availableUsername returns base, or base with a random suffix when taken
+func (h *Handler) availableUsername(ctx context.Context, base string) (string, error) {
+	name := base
+	for i := 0; i < 5; i++ {
+		_, err := h.Users.FindByUsername(ctx, name)
+		if errors.Is(err, user.ErrUserNotFound) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s%04d", base, n)
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
+
+// ListIdentities handle list linked identities request
+func (h *Handler) ListIdentities(c *gin.Context) {
+	identities := []Identity{}
+	if result := h.DB.Where("user_id = ?", c.Param("uid")).Order("id").Find(&identities); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, identities)
+}
+
+// DeleteIdentity handle unlink identity request
+func (h *Handler) DeleteIdentity(c *gin.Context) {
+	result := h.DB.Where("id = ? AND user_id = ?", c.Param("iid"), c.Param("uid")).Delete(&Identity{})
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	} else if result.RowsAffected == 0 {
+		apperror.Abort(c, errIdentityNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "identity unlinked",
+	})
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned when the token has expired or was revoked
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRefreshReused is returned along with the session when a rotated
+	// refresh token is replayed, the store revokes the session beforehand
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// Tokens represents the access and refresh token issued to a session.
+// AccessToken is empty when access tokens are signed JWTs, those are
+// verified without the store.
+type Tokens struct {
+	AccessToken  string
+	AccessTTL    time.Duration
+	RefreshToken string
+	RefreshTTL   time.Duration
+}
+
+// TokenStore persists sessions and the tokens issued for them.
+// Implementations must never keep raw tokens, only their hashes.
+type TokenStore interface {
+	// Issue stores a new session with its first tokens, the session
+	// expires at s.ExpiresAt or after the refresh TTL when that is zero
+	Issue(ctx context.Context, s Session, t Tokens) error
+	// Lookup returns the session of an access token
+	Lookup(ctx context.Context, accessToken string) (Session, error)
+	// Rotate replaces the current refresh token of its session with next,
+	// the session expiry is left to Touch
+	Rotate(ctx context.Context, refreshToken string, next Tokens) (Session, error)
+	// Get returns the session by its id
+	Get(ctx context.Context, sid string) (Session, error)
+	// Touch records activity on the session and moves its expiry to
+	// expiresAt, it never resurrects an expired session
+	Touch(ctx context.Context, sid string, at time.Time, expiresAt time.Time) error
+	// Revoke deletes the session and every token issued to it
+	Revoke(ctx context.Context, uid string, sid string) error
+	// RevokeAll deletes every session of the user
+	RevokeAll(ctx context.Context, uid string) error
+	// ListByUser returns the active sessions of the user
+	ListByUser(ctx context.Context, uid string) ([]Session, error)
+	// Deny marks token or session ids as revoked until ttl passes
+	Deny(ctx context.Context, ttl time.Duration, ids ...string) error
+	// Denied reports whether any of the ids was revoked
+	Denied(ctx context.Context, ids ...string) (bool, error)
+}
+
+// hashToken returns the key under which a token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
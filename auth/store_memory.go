@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in process memory. It is meant for tests and
+// single node deployments, sessions are lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*memorySession
+	access   map[string]memoryToken
+	refresh  map[string]memoryToken
+	denied   map[string]time.Time
+}
+
+type memorySession struct {
+	Session
+	refresh   string
+	expiresAt time.Time
+}
+
+type memoryToken struct {
+	sid       string
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates empty in-memory token store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]*memorySession{},
+		access:   map[string]memoryToken{},
+		refresh:  map[string]memoryToken{},
+		denied:   map[string]time.Time{},
+	}
+}
+
+// Issue stores a new session with its first tokens
+func (m *MemoryStore) Issue(ctx context.Context, s Session, t Tokens) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	expiresAt := s.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(t.RefreshTTL)
+	}
+	m.sessions[s.ID] = &memorySession{
+		Session:   s,
+		refresh:   hashToken(t.RefreshToken),
+		expiresAt: expiresAt,
+	}
+	if t.AccessToken != "" {
+		m.access[hashToken(t.AccessToken)] = memoryToken{sid: s.ID, expiresAt: now.Add(t.AccessTTL)}
+	}
+	m.refresh[hashToken(t.RefreshToken)] = memoryToken{sid: s.ID, expiresAt: now.Add(t.RefreshTTL)}
+	return nil
+}
+
+// Lookup returns the session of an access token
+func (m *MemoryStore) Lookup(ctx context.Context, accessToken string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	t, ok := m.access[hashToken(accessToken)]
+	if !ok || !now.Before(t.expiresAt) {
+		return Session{}, ErrSessionNotFound
+	}
+	s, ok := m.session(t.sid, now)
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return s.Session, nil
+}
+
+// Rotate replaces the current refresh token of its session with next.
+// The rotated token is kept until it expires to detect reuse.
+func (m *MemoryStore) Rotate(ctx context.Context, refreshToken string, next Tokens) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	hash := hashToken(refreshToken)
+	t, ok := m.refresh[hash]
+	if !ok || !now.Before(t.expiresAt) {
+		return Session{}, ErrSessionNotFound
+	}
+	s, ok := m.session(t.sid, now)
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	if s.refresh != hash {
+		delete(m.sessions, s.ID)
+		return s.Session, ErrRefreshReused
+	}
+
+	s.refresh = hashToken(next.RefreshToken)
+	if next.AccessToken != "" {
+		m.access[hashToken(next.AccessToken)] = memoryToken{sid: s.ID, expiresAt: now.Add(next.AccessTTL)}
+	}
+	m.refresh[s.refresh] = memoryToken{sid: s.ID, expiresAt: now.Add(next.RefreshTTL)}
+	return s.Session, nil
+}
+
+// Get returns the session by its id
+func (m *MemoryStore) Get(ctx context.Context, sid string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.session(sid, time.Now())
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return s.Session, nil
+}
+
+// Touch records activity on the session and moves its expiry
+func (m *MemoryStore) Touch(ctx context.Context, sid string, at time.Time, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.session(sid, time.Now()); ok {
+		s.LastSeen = at
+		s.ExpiresAt = expiresAt
+		s.expiresAt = expiresAt
+	}
+	return nil
+}
+
+// Revoke deletes the session, tokens pointing at it stop working immediately
+func (m *MemoryStore) Revoke(ctx context.Context, uid string, sid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sid]; ok && s.UserID == uid {
+		delete(m.sessions, sid)
+	}
+	return nil
+}
+
+// RevokeAll deletes every session of the user
+func (m *MemoryStore) RevokeAll(ctx context.Context, uid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for sid, s := range m.sessions {
+		if s.UserID == uid {
+			delete(m.sessions, sid)
+		}
+	}
+	return nil
+}
+
+// ListByUser returns the active sessions of the user, oldest first
+func (m *MemoryStore) ListByUser(ctx context.Context, uid string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := []Session{}
+	for sid, s := range m.sessions {
+		if s.UserID != uid {
+			continue
+		}
+		if _, ok := m.session(sid, now); ok {
+			sessions = append(sessions, s.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// Deny marks token or session ids as revoked until ttl passes
+func (m *MemoryStore) Deny(ctx context.Context, ttl time.Duration, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	for _, id := range ids {
+		m.denied[id] = expiresAt
+	}
+	return nil
+}
+
+// Denied reports whether any of the ids was revoked
+func (m *MemoryStore) Denied(ctx context.Context, ids ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if expiresAt, ok := m.denied[id]; ok && now.Before(expiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// session returns the live session, expired ones are dropped on access
+func (m *MemoryStore) session(sid string, now time.Time) (*memorySession, bool) {
+	s, ok := m.sessions[sid]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(s.expiresAt) {
+		delete(m.sessions, sid)
+		return nil, false
+	}
+	return s, true
+}
+
+// sweep drops expired entries so tokens that are never used again
+// don't pile up
+func (m *MemoryStore) sweep(now time.Time) {
+	for sid := range m.sessions {
+		m.session(sid, now)
+	}
+	for hash, t := range m.access {
+		if _, ok := m.sessions[t.sid]; !ok || !now.Before(t.expiresAt) {
+			delete(m.access, hash)
+		}
+	}
+	for hash, t := range m.refresh {
+		if _, ok := m.sessions[t.sid]; !ok || !now.Before(t.expiresAt) {
+			delete(m.refresh, hash)
+		}
+	}
+	for id, expiresAt := range m.denied {
+		if !now.Before(expiresAt) {
+			delete(m.denied, id)
+		}
+	}
+}
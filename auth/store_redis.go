@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps sessions in redis so they are shared by every instance
+type RedisStore struct {
+	Client *redis.Client
+}
+
+func sessionKey(sid string) string {
+	return "session:" + sid
+}
+
+func accessKey(token string) string {
+	return "access:" + hashToken(token)
+}
+
+func refreshKey(token string) string {
+	return "refresh:" + hashToken(token)
+}
+
+func deniedKey(id string) string {
+	return "denied:" + id
+}
+
+// userSessionsKey returns key of the set indexing active sessions of a user
+func userSessionsKey(uid string) string {
+	return "user_sessions:" + uid
+}
+
+// Issue stores a new session with its first tokens
+func (r *RedisStore) Issue(ctx context.Context, s Session, t Tokens) error {
+	key := userSessionsKey(s.UserID)
+
+	pipe := r.Client.TxPipeline()
+	pipe.HSet(ctx, sessionKey(s.ID),
+		"uid", s.UserID,
+		"role", s.Role,
+		"created_at", s.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"last_seen", s.LastSeen.UTC().Format(time.RFC3339Nano),
+		"expires_at", s.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		"ip", s.IP,
+		"user_agent", s.UserAgent,
+		"refresh", hashToken(t.RefreshToken),
+	)
+	if s.ExpiresAt.IsZero() {
+		pipe.Expire(ctx, sessionKey(s.ID), t.RefreshTTL)
+	} else {
+		pipe.ExpireAt(ctx, sessionKey(s.ID), s.ExpiresAt)
+	}
+	if t.AccessToken != "" {
+		pipe.Set(ctx, accessKey(t.AccessToken), s.ID, t.AccessTTL)
+	}
+	pipe.Set(ctx, refreshKey(t.RefreshToken), s.ID, t.RefreshTTL)
+	pipe.SAdd(ctx, key, s.ID)
+	// the index lives as long as the newest session it holds
+	pipe.Expire(ctx, key, t.RefreshTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Lookup returns the session of an access token
+func (r *RedisStore) Lookup(ctx context.Context, accessToken string) (Session, error) {
+	sid, err := r.Client.Get(ctx, accessKey(accessToken)).Result()
+	if err == redis.Nil {
+		return Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	return r.Get(ctx, sid)
+}
+
+// rotateScript swaps the current refresh token of a session. It fails
+// when the session is gone and reports reuse when the presented token is
+// not the current one, so two concurrent refreshes can't both succeed.
+var rotateScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if redis.call("HGET", KEYS[1], "refresh") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "refresh", ARGV[2])
+return 1
+`)
+
+// Rotate replaces the current refresh token of its session with next.
+// The rotated token is kept until it expires to detect reuse.
+func (r *RedisStore) Rotate(ctx context.Context, refreshToken string, next Tokens) (Session, error) {
+	sid, err := r.Client.Get(ctx, refreshKey(refreshToken)).Result()
+	if err == redis.Nil {
+		return Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	s, err := r.Get(ctx, sid)
+	if err != nil {
+		return Session{}, err
+	}
+
+	rotated, err := rotateScript.Run(ctx, r.Client, []string{sessionKey(sid)},
+		hashToken(refreshToken), hashToken(next.RefreshToken)).Int()
+	if err != nil {
+		return Session{}, err
+	}
+	switch rotated {
+	case -1:
+		return Session{}, ErrSessionNotFound
+	case 0:
+		if err := r.Revoke(ctx, s.UserID, sid); err != nil {
+			return Session{}, err
+		}
+		return s, ErrRefreshReused
+	}
+
+	pipe := r.Client.TxPipeline()
+	if next.AccessToken != "" {
+		pipe.Set(ctx, accessKey(next.AccessToken), sid, next.AccessTTL)
+	}
+	pipe.Set(ctx, refreshKey(next.RefreshToken), sid, next.RefreshTTL)
+	pipe.Expire(ctx, userSessionsKey(s.UserID), next.RefreshTTL)
+	_, err = pipe.Exec(ctx)
+	return s, err
+}
+
+// Get returns the session by its id
+func (r *RedisStore) Get(ctx context.Context, sid string) (Session, error) {
+	fields, err := r.Client.HGetAll(ctx, sessionKey(sid)).Result()
+	if err != nil {
+		return Session{}, err
+	}
+	if fields["uid"] == "" {
+		return Session{}, ErrSessionNotFound
+	}
+
+	s := Session{
+		ID:        sid,
+		UserID:    fields["uid"],
+		Role:      fields["role"],
+		IP:        fields["ip"],
+		UserAgent: fields["user_agent"],
+	}
+	s.CreatedAt, _ = time.Parse(time.RFC3339Nano, fields["created_at"])
+	s.LastSeen, _ = time.Parse(time.RFC3339Nano, fields["last_seen"])
+	s.ExpiresAt, _ = time.Parse(time.RFC3339Nano, fields["expires_at"])
+	return s, nil
+}
+
+// touchScript updates last seen and expiry of a session without
+// resurrecting it when it expired after the lookup
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "last_seen", ARGV[1], "expires_at", ARGV[2])
+	return redis.call("PEXPIREAT", KEYS[1], ARGV[3])
+end
+return 0
+`)
+
+// Touch records activity on the session and moves its expiry
+func (r *RedisStore) Touch(ctx context.Context, sid string, at time.Time, expiresAt time.Time) error {
+	return touchScript.Run(ctx, r.Client, []string{sessionKey(sid)},
+		at.UTC().Format(time.RFC3339Nano), expiresAt.UTC().Format(time.RFC3339Nano),
+		expiresAt.UnixNano()/int64(time.Millisecond)).Err()
+}
+
+// Revoke deletes the session and removes it from the user's index,
+// access and refresh tokens pointing at it stop working immediately
+func (r *RedisStore) Revoke(ctx context.Context, uid string, sid string) error {
+	pipe := r.Client.TxPipeline()
+	pipe.Del(ctx, sessionKey(sid))
+	pipe.SRem(ctx, userSessionsKey(uid), sid)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAll deletes every session of the user
+func (r *RedisStore) RevokeAll(ctx context.Context, uid string) error {
+	key := userSessionsKey(uid)
+
+	sids, err := r.Client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, sid := range sids {
+		keys = append(keys, sessionKey(sid))
+	}
+	return r.Client.Del(ctx, keys...).Err()
+}
+
+// ListByUser returns active sessions of the user and drops expired
+// entries from the index
+func (r *RedisStore) ListByUser(ctx context.Context, uid string) ([]Session, error) {
+	key := userSessionsKey(uid)
+
+	sids, err := r.Client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, sid := range sids {
+		s, err := r.Get(ctx, sid)
+		if err == ErrSessionNotFound {
+			r.Client.SRem(ctx, key, sid)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// Deny marks token or session ids as revoked until ttl passes
+func (r *RedisStore) Deny(ctx context.Context, ttl time.Duration, ids ...string) error {
+	pipe := r.Client.TxPipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, deniedKey(id), 1, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Denied reports whether any of the ids was revoked
+func (r *RedisStore) Denied(ctx context.Context, ids ...string) (bool, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, deniedKey(id))
+	}
+	n, err := r.Client.Exists(ctx, keys...).Result()
+	return n > 0, err
+}
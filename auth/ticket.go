@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTicketNotFound is returned when the ticket has expired, was already
+// used or never existed
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// purposes of tickets, a ticket issued for one purpose can't be taken
+// for another
+const (
+	PasswordResetTicket     = "password_reset"
+	EmailVerificationTicket = "email_verification"
+	TwoFactorTicket         = "two_factor"
+	OIDCStateTicket         = "oidc_state"
+	OAuthCodeTicket         = "oauth_code"
+)
+
+// TicketStore keeps single-use, expiring tickets such as password reset
+// tokens. Implementations must never keep raw tickets, only their hashes.
+type TicketStore interface {
+	// Put stores the value under the ticket until ttl passes
+	Put(ctx context.Context, purpose, ticket, value string, ttl time.Duration) error
+	// Take returns the value of the ticket and deletes it
+	Take(ctx context.Context, purpose, ticket string) (string, error)
+}
+
+func ticketKey(purpose, ticket string) string {
+	return "ticket:" + purpose + ":" + hashToken(ticket)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTicketStore keeps tickets in process memory, for tests and single
+// node deployments
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]memoryTicket
+}
+
+type memoryTicket struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryTicketStore creates empty in-memory ticket store
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{
+		tickets: map[string]memoryTicket{},
+	}
+}
+
+// Put stores the value under the ticket until ttl passes
+func (m *MemoryTicketStore) Put(ctx context.Context, purpose, ticket, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range m.tickets {
+		if !now.Before(t.expiresAt) {
+			delete(m.tickets, k)
+		}
+	}
+	m.tickets[ticketKey(purpose, ticket)] = memoryTicket{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Take returns the value of the ticket and deletes it
+func (m *MemoryTicketStore) Take(ctx context.Context, purpose, ticket string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := ticketKey(purpose, ticket)
+	t, ok := m.tickets[key]
+	delete(m.tickets, key)
+	if !ok || !time.Now().Before(t.expiresAt) {
+		return "", ErrTicketNotFound
+	}
+	return t.value, nil
+}
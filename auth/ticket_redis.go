@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisTicketStore keeps tickets in redis so they are shared by every instance
+type RedisTicketStore struct {
+	Client *redis.Client
+}
+
+// Put stores the value under the ticket until ttl passes
+func (r *RedisTicketStore) Put(ctx context.Context, purpose, ticket, value string, ttl time.Duration) error {
+	return r.Client.Set(ctx, ticketKey(purpose, ticket), value, ttl).Err()
+}
+
+// Take returns the value of the ticket and deletes it
+func (r *RedisTicketStore) Take(ctx context.Context, purpose, ticket string) (string, error) {
+	key := ticketKey(purpose, ticket)
+
+	pipe := r.Client.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err == redis.Nil {
+		return "", ErrTicketNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/database"
+	"example.com/social-gin/totp"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	challengeTTL       = time.Minute * 5
+	recoveryCodeCount  = 10
+	defaultTOTPIssuer  = "social-gin"
+	recoveryCodeLength = 10
+)
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost, only its hash is stored
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index"`
+	Hash      string `gorm:"size:64"`
+	UsedAt    *time.Time
+}
+
+// TwoFactorRequest represents a second factor, either a TOTP code or a
+// recovery code
+type TwoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorLoginRequest represents second step of login request body
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	TwoFactorRequest
+}
+
+// TwoFactorChallengeResponse is returned by LogIn instead of tokens when
+// the user has 2FA enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// EnrollResponse represents enroll 2FA response
+type EnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (h *Handler) totpIssuer() string {
+	if h.TOTPIssuer == "" {
+		return defaultTOTPIssuer
+	}
+	return h.TOTPIssuer
+}
+
+// normalizeRecoveryCode lets users type codes in any case, with or
+// without the dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength*5/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+// challengeTwoFactor responds with a single-use challenge token that
+// LogInTwoFactor exchanges for a session
+func (h *Handler) challengeTwoFactor(c *gin.Context, u user.User) {
+	token := uuid.New().String()
+	if err := h.Tickets.Put(c.Request.Context(), TwoFactorTicket, token, strconv.Itoa(int(u.ID)), challengeTTL); err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         time.Now().Add(challengeTTL),
+	})
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code of the user
+func (h *Handler) verifySecondFactor(ctx context.Context, u user.User, req TwoFactorRequest) (bool, error) {
+	if req.Code != "" {
+		step, ok, err := totp.Validate(u.TOTPSecret, req.Code, time.Now(), u.TOTPLastStep)
+		if err != nil || !ok {
+			return false, err
+		}
+		// a concurrent request may have used the same code already
+		return h.Users.AdvanceTOTPStep(ctx, u.ID, step)
+	}
+	if req.RecoveryCode != "" {
+		result := h.DB.WithContext(ctx).Model(&RecoveryCode{}).
+			Where("user_id = ? AND hash = ? AND used_at IS NULL", u.ID, hashToken(normalizeRecoveryCode(req.RecoveryCode))).
+			Update("used_at", time.Now().UTC())
+		return result.RowsAffected == 1, result.Error
+	}
+	return false, nil
+}
+
+// LogInTwoFactor handle second step of login, it exchanges the challenge
+// token and a TOTP or recovery code for a session. The challenge can
+// only be tried once.
+func (h *Handler) LogInTwoFactor(c *gin.Context) {
+	req := TwoFactorLoginRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		apperror.Abort(c, errMissingChallenge)
+		return
+	}
+
+	uid, err := h.Tickets.Take(c.Request.Context(), TwoFactorTicket, req.ChallengeToken)
+	if err == ErrTicketNotFound {
+		apperror.Abort(c, errInvalidChallenge)
+		return
+	} else if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+
+	u, err := h.findUser(c.Request.Context(), uid)
+	if errors.Is(err, user.ErrUserNotFound) {
+		apperror.Abort(c, errInvalidChallenge)
+		return
+	} else if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if !u.TOTPEnabled {
+		apperror.Abort(c, errInvalidChallenge)
+		return
+	}
+
+	if !h.allowLogin(c, u.Username) {
+		return
+	}
+
+	ok, err := h.verifySecondFactor(c.Request.Context(), u, req.TwoFactorRequest)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if !ok {
+		h.recordLoginFailure(c, u.Username, "invalid second factor")
+		apperror.Abort(c, errWrongCode)
+		return
+	}
+
+	h.completeLogin(c, u)
+}
+
+// EnrollTwoFactor handle enroll 2FA request, it generates a new secret
+// that is only enforced once confirmed with a first code
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	u, err := h.findUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if u.TOTPEnabled {
+		apperror.Abort(c, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	u.TOTPSecret = secret
+	u.TOTPLastStep = 0
+	if err := h.Users.Update(c.Request.Context(), &u, "TOTPSecret", "TOTPLastStep"); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(h.totpIssuer(), u.Username, secret),
+	})
+}
+
+// ConfirmTwoFactor handle confirm 2FA request, a valid first code enables
+// 2FA and returns the recovery codes, they are never shown again
+func (h *Handler) ConfirmTwoFactor(c *gin.Context) {
+	req := TwoFactorRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.Code == "" {
+		apperror.Abort(c, errMissingCode)
+		return
+	}
+
+	u, err := h.findUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if u.TOTPEnabled || u.TOTPSecret == "" {
+		apperror.Abort(c, errNoPendingEnrollment)
+		return
+	}
+
+	ok, err := h.verifySecondFactor(c.Request.Context(), u, TwoFactorRequest{Code: req.Code})
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if !ok {
+		apperror.Abort(c, errInvalidCode)
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		codes[i] = code
+		records[i] = RecoveryCode{UserID: u.ID, Hash: hashToken(normalizeRecoveryCode(code))}
+	}
+
+	ctx := c.Request.Context()
+	err = h.Users.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, h.DB)
+		if err := tx.Where("user_id = ?", u.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		u.TOTPEnabled = true
+		return h.Users.Update(ctx, &u, "TOTPEnabled")
+	})
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.recordChange(c, audit.ActionTwoFactorEnable, audit.TargetUser, c.Param("uid"))
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor handle disable 2FA request, the owner has to prove
+// possession with a code, users allowed to update anyone don't
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	req := TwoFactorRequest{}
+	if c.Request.ContentLength != 0 {
+		if !validation.Bind(c, &req) {
+			return
+		}
+	}
+
+	u, err := h.findUser(c.Request.Context(), c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if c.GetString("uid") == c.Param("uid") && u.TOTPEnabled {
+		ok, err := h.verifySecondFactor(c.Request.Context(), u, req)
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		if !ok {
+			apperror.Abort(c, errInvalidCode)
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	err = h.Users.WithinTx(ctx, func(ctx context.Context) error {
+		if err := database.Conn(ctx, h.DB).Where("user_id = ?", u.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		u.TOTPSecret = ""
+		u.TOTPEnabled = false
+		u.TOTPLastStep = 0
+		return h.Users.Update(ctx, &u, "TOTPSecret", "TOTPEnabled", "TOTPLastStep")
+	})
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.recordChange(c, audit.ActionTwoFactorDisable, audit.TargetUser, c.Param("uid"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "two factor authentication disabled",
+	})
+}
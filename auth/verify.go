@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/mail"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultVerifyTTL = time.Hour * 24
+
+func (h *Handler) verifyTTL() time.Duration {
+	if h.VerifyTTL == 0 {
+		return defaultVerifyTTL
+	}
+	return h.VerifyTTL
+}
+
+// SendVerification mails the user a link that verifies their current
+// email. The ticket is bound to the address so a link sent before an
+// email change can't verify the new one.
+func (h *Handler) SendVerification(ctx context.Context, u user.User) error {
+	token := uuid.New().String()
+	value := strconv.Itoa(int(u.ID)) + ":" + u.Email
+	if err := h.Tickets.Put(ctx, EmailVerificationTicket, token, value, h.verifyTTL()); err != nil {
+		return err
+	}
+	return h.Mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %s to verify your email:\n\n%s\n",
+			u.Name, h.verifyTTL(), h.link("/verify-email?token="+url.QueryEscape(token))),
+	})
+}
+
+// VerifyEmail handle verify email request
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		apperror.Abort(c, errMissingVerifyToken)
+		return
+	}
+
+	value, err := h.Tickets.Take(c.Request.Context(), EmailVerificationTicket, token)
+	if err == ErrTicketNotFound {
+		apperror.Abort(c, errInvalidVerifyToken)
+		return
+	} else if err != nil {
+		apperror.Abort(c, errTokenStore.Wrap(err))
+		return
+	}
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		apperror.Abort(c, errInvalidVerifyToken)
+		return
+	}
+	uid, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		apperror.Abort(c, errInvalidVerifyToken)
+		return
+	}
+
+	err = h.Users.MarkVerified(c.Request.Context(), uint(uid), parts[1])
+	if errors.Is(err, user.ErrUserNotFound) {
+		// the email was changed after the link was sent
+		apperror.Abort(c, errInvalidVerifyToken)
+		return
+	} else if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified",
+	})
+}
+
+// RequireVerified only lets through users who verified their email,
+// it must run after Authorize
+func (h *Handler) RequireVerified(c *gin.Context) {
+	u, err := h.findUser(c.Request.Context(), c.GetString("uid"))
+	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		apperror.Abort(c, err)
+		return
+	}
+	if u.VerifiedAt == nil {
+		apperror.Abort(c, errEmailNotVerified)
+		return
+	}
+}
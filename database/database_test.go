@@ -0,0 +1,90 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"example.com/social-gin/database"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestDriverFromScheme(t *testing.T) {
+	cases := map[string]string{
+		"sqlserver://localhost:1433?database=social1": database.SQLServer,
+		"postgres://localhost:5432/social1":           database.Postgres,
+		"postgresql://localhost/social1":              database.Postgres,
+		"mysql://sert11@tcp(localhost:3306)/social1":  database.MySQL,
+		"sqlite://social.db":                          database.SQLite,
+		"SQLite3://file::memory:":                     database.SQLite,
+		"oracle://localhost/social1":                  "",
+		"social.db":                                   "",
+	}
+	for dsn, want := range cases {
+		assert.Equal(t, want, database.Driver(dsn), dsn)
+	}
+}
+
+func TestDialector(t *testing.T) {
+	cases := map[string]string{
+		"sqlserver://localhost:1433?database=social1": "sqlserver",
+		"postgres://localhost:5432/social1":           "postgres",
+		"mysql://sert11@tcp(localhost:3306)/social1":  "mysql",
+		"sqlite://social.db":                          "sqlite",
+	}
+	for dsn, want := range cases {
+		d, err := database.Dialector("", dsn)
+		if assert.NoError(t, err, dsn) {
+			assert.Equal(t, want, d.Name(), dsn)
+		}
+	}
+
+	// an explicit driver takes a dsn without scheme
+	d, err := database.Dialector(database.SQLite, "social.db")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sqlite", d.Name())
+	}
+
+	_, err = database.Dialector("", "oracle://localhost/social1")
+	assert.True(t, errors.Is(err, database.ErrUnknownDriver))
+	_, err = database.Dialector("", "mysql://localhost:3306")
+	assert.Error(t, err)
+}
+
+func TestOpenSQLite(t *testing.T) {
+	db, err := database.Open("", "sqlite://file::memory:", &gorm.Config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type thing struct {
+		ID   uint
+		Name string
+	}
+	assert.NoError(t, db.AutoMigrate(&thing{}))
+	assert.True(t, db.Migrator().HasTable(&thing{}))
+	assert.NoError(t, db.Create(&thing{Name: "one"}).Error)
+
+	got := thing{}
+	assert.NoError(t, db.First(&got).Error)
+	assert.Equal(t, "one", got.Name)
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	db, err := database.Open("", "sqlite://file::memory:", &gorm.Config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type thing struct {
+		ID   uint
+		Name string `gorm:"uniqueIndex"`
+	}
+	assert.NoError(t, db.AutoMigrate(&thing{}))
+	assert.NoError(t, db.Create(&thing{Name: "one"}).Error)
+	assert.True(t, database.IsUniqueViolation(db.Create(&thing{Name: "one"}).Error))
+
+	assert.True(t, database.IsUniqueViolation(&mysqldriver.MySQLError{Number: 1062}))
+	assert.False(t, database.IsUniqueViolation(&mysqldriver.MySQLError{Number: 1146}))
+	assert.False(t, database.IsUniqueViolation(errors.New("connection refused")))
+	assert.False(t, database.IsUniqueViolation(nil))
+}
@@ -4,17 +4,32 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-const loggerKey = "logger"
+const (
+	loggerKey    = "logger"
+	requestIDKey = "request_id"
+	// RequestIDHeader carries the request id from proxies and back to clients
+	RequestIDHeader = "X-Request-ID"
+)
 
 // Middleware return middleware function
 func Middleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		t := time.Now()
 
-		l := logger.With((zap.String("id", c.GetHeader("X-Request-ID"))))
+		// requests without an id from the proxy get one so log lines and
+		// audit events of a request can be matched
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		l := logger.With((zap.String("id", id)))
 		c.Set(loggerKey, l)
 
 		c.Next()
@@ -24,7 +39,7 @@ func Middleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.Int("status", c.Writer.Status()),
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
-			zap.String("query", c.Request.URL.RawQuery),
+			Query("query", c.Request.URL.RawQuery),
 			zap.String("ip", c.ClientIP()),
 			zap.String("user-agent", c.Request.UserAgent()),
 			zap.Duration("latency", latency),
@@ -32,11 +47,16 @@ func Middleware(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
+// RequestID returns id of the request set by Middleware
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
 // Extract extract zap logger from context
 func Extract(c *gin.Context) *zap.Logger {
 	l, ok := c.Get(loggerKey)
 	if ok {
 		return l.(*zap.Logger)
 	}
-	return zap.NewExample()
+	return zap.NewExample(Redact())
 }
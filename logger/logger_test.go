@@ -0,0 +1,156 @@
+package logger_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const secret = "s3cr3t-value"
+
+func newLogger(buf *bytes.Buffer, keys ...string) *zap.Logger {
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buf),
+		zapcore.DebugLevel,
+	)
+	return zap.New(logger.NewRedactingCore(core, keys...))
+}
+
+func TestRedactSensitiveFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf)
+
+	l.Info("login",
+		zap.String("password", secret),
+		zap.String("refresh_token", secret),
+		zap.String("Authorization", "Bearer "+secret),
+		zap.String("email", secret+"@example.com"),
+		zap.String("username", "alice"),
+	)
+	l.With(zap.String("token", secret)).Warn("with fields")
+	l.Error("message password=" + secret + " token: " + secret)
+
+	out := buf.String()
+	assert.NotContains(t, out, secret)
+	assert.Contains(t, out, logger.Redacted)
+	assert.Contains(t, out, `"username":"alice"`)
+}
+
+func TestRedactConfiguredKeys(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf, "ssn")
+
+	l.Info("configured", zap.String("SSN", secret), zap.String("password", "kept"))
+
+	assert.NotContains(t, buf.String(), secret)
+	assert.Contains(t, buf.String(), `"password":"kept"`)
+}
+
+func TestQueryUsesConfiguredKeys(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf, "ssn")
+
+	l.Info("configured", logger.Query("query", "page=2&ssn="+secret+"&password=kept"))
+
+	assert.NotContains(t, buf.String(), secret)
+	assert.Contains(t, buf.String(), "password=kept")
+	assert.Contains(t, buf.String(), "page=2")
+
+	// without the redacting core the default keys are masked
+	buf.Reset()
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zapcore.DebugLevel)
+	zap.New(core).Info("plain", logger.Query("query", "token="+secret))
+	assert.NotContains(t, buf.String(), secret)
+}
+
+func TestFieldHelpers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf)
+
+	l.Info("helpers",
+		logger.Secret("otp", secret),
+		logger.Token("token", secret),
+		logger.Email("email", "alice@example.com"),
+		logger.Query("query", "page=2&token="+secret),
+		logger.Plain("code", "invalid_token"),
+		zap.Error(errors.New("boom")),
+	)
+
+	out := buf.String()
+	assert.NotContains(t, out, secret)
+	assert.NotContains(t, out, "alice@")
+	assert.Contains(t, out, `"token":"sha256:`)
+	assert.Contains(t, out, `"email":"a***@example.com"`)
+	assert.Contains(t, out, "page=2")
+	assert.Contains(t, out, `"code":"invalid_token"`)
+}
+
+func TestMiddlewareRedactsQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &bytes.Buffer{}
+	l := newLogger(buf)
+
+	r := gin.New()
+	r.Use(logger.Middleware(l))
+	r.GET("/verify", func(c *gin.Context) {
+		logger.Extract(c).Info("verifying", zap.String("token", c.Query("token")))
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/verify?token="+secret, nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, buf.String(), secret)
+}
+
+func TestMiddlewareRedactsCallbackCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &bytes.Buffer{}
+	l := newLogger(buf)
+
+	r := gin.New()
+	r.Use(logger.Middleware(l))
+	r.GET("/auth/:provider/callback", func(c *gin.Context) {
+		c.Status(http.StatusFound)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=abc&code="+secret+"&client_secret="+secret, nil))
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.NotContains(t, buf.String(), secret)
+	assert.Contains(t, buf.String(), "state=abc")
+}
+
+func TestMiddlewareSetsRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logger.Middleware(zap.NewNop()))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, logger.RequestID(c))
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, rec.Body.String())
+	assert.Equal(t, rec.Body.String(), rec.Header().Get("X-Request-ID"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "from-proxy")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, "from-proxy", rec.Body.String())
+	assert.Equal(t, "from-proxy", rec.Header().Get("X-Request-ID"))
+}
@@ -0,0 +1,190 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the value of sensitive fields
+const Redacted = "[REDACTED]"
+
+// DefaultSensitiveKeys are masked when no keys are configured, a field is
+// sensitive when its key contains one of them, ignoring case
+var DefaultSensitiveKeys = []string{"password", "token", "authorization", "email", "code", "secret"}
+
+// masked is a value already made safe by one of the field helpers, the
+// redacting core leaves it as is
+type masked string
+
+func (m masked) String() string {
+	return string(m)
+}
+
+// Secret returns field that never logs the value
+func Secret(key string, value string) zap.Field {
+	if value == "" {
+		return zap.Stringer(key, masked(""))
+	}
+	return zap.Stringer(key, masked(Redacted))
+}
+
+// Plain returns field that logs the value as is, for values under keys
+// that look sensitive but aren't, such as error codes
+func Plain(key string, value string) zap.Field {
+	return zap.Stringer(key, masked(value))
+}
+
+// Token returns field that logs a short fingerprint of the token, enough
+// to correlate log lines without being able to use the token
+func Token(key string, token string) zap.Field {
+	if token == "" {
+		return zap.Stringer(key, masked(""))
+	}
+	sum := sha256.Sum256([]byte(token))
+	return zap.Stringer(key, masked("sha256:"+hex.EncodeToString(sum[:4])))
+}
+
+// Email returns field that logs the email with the local part masked
+func Email(key string, email string) zap.Field {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return Secret(key, email)
+	}
+	return zap.Stringer(key, masked(email[:1]+"***"+email[at:]))
+}
+
+// rawQuery is a query string the redacting core masks with its configured
+// keys, without the core the default keys are masked
+type rawQuery string
+
+func (q rawQuery) String() string {
+	return defaultRedactor.query(string(q))
+}
+
+// Query returns field that logs the raw query string with values of
+// sensitive parameters masked
+func Query(key string, raw string) zap.Field {
+	return zap.Stringer(key, rawQuery(raw))
+}
+
+type redactor struct {
+	keys    []string
+	message *regexp.Regexp
+}
+
+func newRedactor(keys []string) redactor {
+	if len(keys) == 0 {
+		keys = DefaultSensitiveKeys
+	}
+	r := redactor{}
+	quoted := []string{}
+	for _, k := range keys {
+		r.keys = append(r.keys, strings.ToLower(k))
+		quoted = append(quoted, regexp.QuoteMeta(k))
+	}
+	// key=value and key: value pairs written into messages
+	r.message = regexp.MustCompile(fmt.Sprintf(`(?i)([\w-]*(?:%s)[\w-]*)(\s*[=:]\s*)("[^"]*"|\S+)`, strings.Join(quoted, "|")))
+	return r
+}
+
+var defaultRedactor = newRedactor(nil)
+
+func (r redactor) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range r.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		q, isQuery := f.Interface.(rawQuery)
+		if _, ok := f.Interface.(masked); ok || (!isQuery && !r.sensitive(f.Key)) {
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		if isQuery {
+			out[i] = zap.String(f.Key, r.query(string(q)))
+		} else {
+			out[i] = zap.String(f.Key, Redacted)
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+func (r redactor) text(s string) string {
+	return r.message.ReplaceAllString(s, "${1}${2}"+Redacted)
+}
+
+// query masks values of sensitive query parameters
+func (r redactor) query(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return r.text(raw)
+	}
+	changed := false
+	for k := range values {
+		if r.sensitive(k) {
+			values[k] = []string{Redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	return values.Encode()
+}
+
+// redactingCore masks sensitive fields before they reach the wrapped core.
+// Only top level field keys are checked, use the field helpers for values
+// nested in objects.
+type redactingCore struct {
+	zapcore.Core
+	r redactor
+}
+
+// NewRedactingCore wraps core so fields whose key matches one of keys, and
+// key=value pairs in messages, are replaced by Redacted
+func NewRedactingCore(core zapcore.Core, keys ...string) zapcore.Core {
+	return &redactingCore{Core: core, r: newRedactor(keys)}
+}
+
+// Redact returns option that wraps the logger core with NewRedactingCore
+func Redact(keys ...string) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return NewRedactingCore(core, keys...)
+	})
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.text(ent.Message)
+	return c.Core.Write(ent, c.r.fields(fields))
+}
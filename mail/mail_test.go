@@ -0,0 +1,36 @@
+package mail_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"example.com/social-gin/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirMailerWritesMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mail.DirMailer{Dir: filepath.Join(dir, "out"), From: "no-reply@example.com"}
+
+	err = m.Send(context.Background(), mail.Message{
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Body:    "open the link",
+	})
+	assert.NoError(t, err)
+
+	files, err := ioutil.ReadDir(m.Dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		b, err := ioutil.ReadFile(filepath.Join(m.Dir, files[0].Name()))
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), "To: alice@example.com\r\n")
+		assert.Contains(t, string(b), "Subject: Reset your password\r\n")
+		assert.Contains(t, string(b), "\r\n\r\nopen the link")
+	}
+}
@@ -0,0 +1,324 @@
+// Package migrate applies versioned SQL migrations to the schema.
+//
+// Migrations are embedded from sql/<driver>/<version>_<name>.up.sql and the
+// matching .down.sql. A statement ends with a semicolon at the end of a
+// line. Changes SQL can't express on every driver are Go migrations,
+// registered in goMigrations and shared by all drivers. Applied versions are
+// recorded in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql
+var files embed.FS
+
+// errors of the migrator
+var (
+	ErrOutOfDate      = errors.New("schema is out of date")
+	ErrUnknownVersion = errors.New("schema has migrations unknown to this build")
+	ErrNothingApplied = errors.New("no migration to roll back")
+)
+
+// Migration is a versioned change of the schema. UpFunc and DownFunc run
+// after the SQL of the migration, in the same transaction.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(tx *gorm.DB) error
+	DownFunc func(tx *gorm.DB) error
+}
+
+// String returns the version and name of the migration
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d %s", m.Version, m.Name)
+}
+
+// Version is a row of the schema version table, one per applied migration
+type Version struct {
+	Version   int64  `gorm:"primarykey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// TableName names the schema version table
+func (Version) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is a migration and when it was applied, AppliedAt is nil while
+// the migration is pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	// Unknown is set for an applied version this build has no migration of
+	Unknown bool
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load returns the embedded migrations of the driver and the Go
+// migrations ordered by version
+func Load(driver string) ([]Migration, error) {
+	migrations, err := LoadFS(files, path.Join("sql", driver))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range migrations {
+		for _, g := range goMigrations {
+			if m.Version == g.Version {
+				return nil, fmt.Errorf("migration %s is both SQL and Go", m)
+			}
+		}
+	}
+	migrations = append(migrations, goMigrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LoadFS returns the migrations in dir ordered by version, every version
+// needs an up and a down file
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s needs an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies migrations to the database
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// Status returns every migration with when it was applied, including
+// applied versions unknown to this build
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		s := Status{Migration: mig}
+		if v, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &v.AppliedAt
+			delete(applied, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for _, v := range applied {
+		v := v
+		status = append(status, Status{
+			Migration: Migration{Version: v.Version, Name: v.Name},
+			AppliedAt: &v.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+// Check returns ErrOutOfDate while migrations are pending and
+// ErrUnknownVersion when the schema was migrated by a newer build
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range status {
+		if s.Unknown {
+			return fmt.Errorf("%w, version %s", ErrUnknownVersion, s.Migration)
+		}
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w, %d pending migrations", ErrOutOfDate, pending)
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order and returns them. Each
+// migration runs in a transaction, it stops at the first that fails.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := run(tx, mig.Up, mig.UpFunc); err != nil {
+				return err
+			}
+			return tx.Create(&Version{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the latest applied migration and returns it
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	var last *Status
+	for i := range status {
+		if status[i].AppliedAt != nil {
+			last = &status[i]
+		}
+	}
+	if last == nil {
+		return Migration{}, ErrNothingApplied
+	}
+	if last.Unknown {
+		return Migration{}, fmt.Errorf("%w, version %s", ErrUnknownVersion, last.Migration)
+	}
+
+	mig := last.Migration
+	err = m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := run(tx, mig.Down, mig.DownFunc); err != nil {
+			return err
+		}
+		return tx.Delete(&Version{}, mig.Version).Error
+	})
+	if err != nil {
+		return Migration{}, fmt.Errorf("migration %s: %w", mig, err)
+	}
+	return mig, nil
+}
+
+// applied returns the applied versions, none when the table is missing
+func (m *Migrator) applied(ctx context.Context) (map[int64]Version, error) {
+	db := m.DB.WithContext(ctx)
+	applied := map[int64]Version{}
+	if !db.Migrator().HasTable(&Version{}) {
+		return applied, nil
+	}
+	versions := []Version{}
+	if err := db.Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		applied[v.Version] = v
+	}
+	return applied, nil
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	db := m.DB.WithContext(ctx)
+	if db.Migrator().HasTable(&Version{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&Version{})
+}
+
+// run executes the SQL and then the function of a migration step
+func run(tx *gorm.DB, sql string, fn func(tx *gorm.DB) error) error {
+	if err := exec(tx, sql); err != nil {
+		return err
+	}
+	if fn == nil {
+		return nil
+	}
+	return fn(tx)
+}
+
+var statementEnd = regexp.MustCompile(`;[ \t]*\r?\n`)
+
+// exec runs the statements of a migration file one by one, as not every
+// driver takes several statements at once
+func exec(tx *gorm.DB, sql string) error {
+	for _, stmt := range statementEnd.Split(sql+"\n", -1) {
+		if onlyComments(stmt) {
+			continue
+		}
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func onlyComments(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
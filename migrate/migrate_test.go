@@ -0,0 +1,200 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"example.com/social-gin/audit"
+	"example.com/social-gin/auth"
+	"example.com/social-gin/database"
+	"example.com/social-gin/migrate"
+	"example.com/social-gin/post"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/user"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var models = []interface{}{&user.User{}, &post.Post{}, &auth.RecoveryCode{}, &auth.APIKey{}, &auth.Identity{}, &auth.OAuthClient{}, &auth.OAuthToken{}, &audit.Event{}}
+
+func open(t *testing.T) *gorm.DB {
+	db, err := database.Open("", "sqlite://file::memory:", &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a new database
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	return db
+}
+
+func TestEveryDriverHasTheSameVersions(t *testing.T) {
+	sqlite, err := migrate.Load(database.SQLite)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, sqlite) {
+		return
+	}
+	for _, driver := range []string{database.SQLServer, database.Postgres, database.MySQL} {
+		migrations, err := migrate.Load(driver)
+		if !assert.NoError(t, err, driver) || !assert.Len(t, migrations, len(sqlite), driver) {
+			continue
+		}
+		for i, m := range migrations {
+			assert.Equal(t, sqlite[i].String(), m.String(), driver)
+		}
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0002_add_bio.up.sql":   {Data: []byte("ALTER TABLE users ADD bio text;")},
+		"sql/0002_add_bio.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN bio;")},
+		"sql/0001_initial.up.sql":   {Data: []byte("CREATE TABLE users (id integer);")},
+		"sql/0001_initial.down.sql": {Data: []byte("DROP TABLE users;")},
+		"sql/README":                {Data: []byte("not a migration")},
+	}
+	migrations, err := migrate.LoadFS(fsys, "sql")
+	if assert.NoError(t, err) && assert.Len(t, migrations, 2) {
+		assert.Equal(t, "0001 initial", migrations[0].String())
+		assert.Equal(t, "0002 add_bio", migrations[1].String())
+		assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+	}
+
+	delete(fsys, "sql/0002_add_bio.down.sql")
+	_, err = migrate.LoadFS(fsys, "sql")
+	assert.Error(t, err)
+}
+
+func TestUpCheckDown(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+	migrations, err := migrate.Load(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &migrate.Migrator{DB: db, Migrations: migrations}
+
+	assert.True(t, errors.Is(m.Check(ctx), migrate.ErrOutOfDate))
+
+	applied, err := m.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	assert.NoError(t, m.Check(ctx))
+	for _, model := range models {
+		assert.True(t, db.Migrator().HasTable(model))
+	}
+	// the schema is the one AutoMigrate expects
+	assert.NoError(t, db.Create(&user.User{Username: "sert4"}).Error)
+	assert.True(t, database.IsUniqueViolation(db.Create(&user.User{Username: "sert4"}).Error))
+
+	applied, err = m.Up(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	for range migrations {
+		_, err := m.Down(ctx)
+		assert.NoError(t, err)
+	}
+	assert.False(t, db.Migrator().HasTable(&user.User{}))
+	_, err = m.Down(ctx)
+	assert.Equal(t, migrate.ErrNothingApplied, err)
+}
+
+func TestUpAdoptsAutoMigratedSchema(t *testing.T) {
+	db := open(t)
+	assert.NoError(t, db.AutoMigrate(models...))
+
+	migrations, err := migrate.Load(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &migrate.Migrator{DB: db, Migrations: migrations}
+	_, err = m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, m.Check(context.Background()))
+}
+
+// baselineUser is the users table before migrations were introduced
+type baselineUser struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt sql.NullTime `gorm:"index"`
+	Username  string       `gorm:"uniquekey"`
+	Password  string
+	Name      string
+	Email     string
+}
+
+func (baselineUser) TableName() string {
+	return "users"
+}
+
+func TestUpAddsColumnsToBaselineUsers(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+	assert.NoError(t, db.AutoMigrate(&baselineUser{}))
+	assert.NoError(t, db.Create(&baselineUser{Username: "sert4", Name: "Sert"}).Error)
+
+	migrations, err := migrate.Load(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &migrate.Migrator{DB: db, Migrations: migrations}
+	_, err = m.Up(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Check(ctx))
+	for _, field := range []string{"VerifiedAt", "Role", "TOTPSecret", "TOTPEnabled", "TOTPLastStep"} {
+		assert.True(t, db.Migrator().HasColumn(&user.User{}, field), field)
+	}
+
+	// existing users get the defaults, new ones are stored in full
+	u := user.User{}
+	if assert.NoError(t, db.Where("username = ?", "sert4").First(&u).Error) {
+		assert.Equal(t, rbac.RoleUser, u.Role)
+		assert.False(t, u.TOTPEnabled)
+		assert.Nil(t, u.VerifiedAt)
+	}
+	assert.NoError(t, db.Create(&user.User{Username: "new", Role: rbac.RoleAdmin, TOTPEnabled: true, TOTPLastStep: 7}).Error)
+	assert.True(t, database.IsUniqueViolation(db.Create(&user.User{Username: "sert4"}).Error))
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+	m := &migrate.Migrator{DB: db, Migrations: []migrate.Migration{
+		{Version: 1, Name: "things", Up: "CREATE TABLE things (id integer);", Down: "DROP TABLE things;"},
+		{Version: 2, Name: "broken", Up: "CREATE TABLE others (id integer);\nCREATE TABLE things (id integer);", Down: "DROP TABLE others;"},
+	}}
+
+	applied, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+	assert.True(t, db.Migrator().HasTable("things"))
+	assert.False(t, db.Migrator().HasTable("others"))
+
+	status, err := m.Status(ctx)
+	if assert.NoError(t, err) && assert.Len(t, status, 2) {
+		assert.NotNil(t, status[0].AppliedAt)
+		assert.Nil(t, status[1].AppliedAt)
+	}
+}
+
+func TestCheckRejectsNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+	newer := &migrate.Migrator{DB: db, Migrations: []migrate.Migration{
+		{Version: 1, Name: "things", Up: "CREATE TABLE things (id integer);", Down: "DROP TABLE things;"},
+		{Version: 2, Name: "others", Up: "CREATE TABLE others (id integer);", Down: "DROP TABLE others;"},
+	}}
+	_, err := newer.Up(ctx)
+	assert.NoError(t, err)
+
+	older := &migrate.Migrator{DB: db, Migrations: newer.Migrations[:1]}
+	assert.True(t, errors.Is(older.Check(ctx), migrate.ErrUnknownVersion))
+	_, err = older.Down(ctx)
+	assert.True(t, errors.Is(err, migrate.ErrUnknownVersion))
+}
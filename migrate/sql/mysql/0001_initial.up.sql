@@ -0,0 +1,120 @@
+-- 0001 creates the schema AutoMigrate used to create, tables and indexes
+-- that already exist are kept so databases created by it can be adopted
+
+CREATE TABLE IF NOT EXISTS `users` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`updated_at` datetime(3) NULL,
+	`deleted_at` datetime(3) NULL,
+	`username` longtext,
+	`password` longtext,
+	`name` longtext,
+	`email` longtext,
+	`verified_at` datetime(3) NULL,
+	`role` varchar(20) DEFAULT 'user',
+	`totp_secret` varchar(64),
+	`totp_enabled` boolean,
+	`totp_last_step` bigint,
+	PRIMARY KEY (`id`),
+	INDEX `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `posts` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`updated_at` datetime(3) NULL,
+	`deleted_at` datetime(3) NULL,
+	`user_id` bigint unsigned,
+	`content` longtext,
+	`likes` bigint,
+	PRIMARY KEY (`id`),
+	INDEX `idx_posts_deleted_at` (`deleted_at`),
+	CONSTRAINT `fk_posts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`user_id` bigint unsigned,
+	`hash` varchar(64),
+	`used_at` datetime(3) NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_recovery_codes_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `api_keys` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`user_id` bigint unsigned,
+	`name` varchar(100),
+	`prefix` varchar(20),
+	`hash` varchar(64),
+	`scopes` varchar(255),
+	`last_used_at` datetime(3) NULL,
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `idx_api_keys_hash` (`hash`),
+	INDEX `idx_api_keys_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `identities` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`user_id` bigint unsigned,
+	`provider` varchar(50),
+	`subject` varchar(255),
+	`email` longtext,
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `idx_identity_subject` (`provider`,`subject`),
+	INDEX `idx_identities_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `o_auth_clients` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`owner_id` bigint unsigned,
+	`client_id` varchar(64),
+	`secret_hash` varchar(64),
+	`name` varchar(100),
+	`redirect_uris` varchar(1000),
+	`scopes` varchar(255),
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `idx_o_auth_clients_client_id` (`client_id`),
+	INDEX `idx_o_auth_clients_owner_id` (`owner_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `o_auth_tokens` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`client_id` varchar(64),
+	`user_id` bigint unsigned,
+	`scopes` varchar(255),
+	`access_hash` varchar(64),
+	`access_expires_at` datetime(3) NULL,
+	`refresh_hash` varchar(64),
+	`refresh_expires_at` datetime(3) NULL,
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `idx_o_auth_tokens_access_hash` (`access_hash`),
+	UNIQUE INDEX `idx_o_auth_tokens_refresh_hash` (`refresh_hash`),
+	INDEX `idx_o_auth_tokens_client_id` (`client_id`),
+	INDEX `idx_o_auth_tokens_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `audit_events` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` datetime(3) NULL,
+	`actor_id` varchar(20),
+	`actor` varchar(100),
+	`action` varchar(50),
+	`target_type` varchar(20),
+	`target_id` varchar(50),
+	`outcome` varchar(10),
+	`detail` varchar(255),
+	`ip` varchar(45),
+	`user_agent` varchar(255),
+	`request_id` varchar(128),
+	PRIMARY KEY (`id`),
+	INDEX `idx_audit_events_created_at` (`created_at`),
+	INDEX `idx_audit_events_actor_id` (`actor_id`),
+	INDEX `idx_audit_events_action` (`action`),
+	INDEX `idx_audit_events_target_id` (`target_id`)
+);
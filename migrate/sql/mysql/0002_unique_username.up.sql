@@ -0,0 +1,5 @@
+-- 0002 makes usernames unique, logins look users up by username. longtext
+-- can't be indexed so the column is shortened first.
+
+ALTER TABLE `users` MODIFY `username` varchar(100);
+CREATE UNIQUE INDEX `idx_users_username` ON `users` (`username`);
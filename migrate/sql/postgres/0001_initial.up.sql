@@ -0,0 +1,120 @@
+-- 0001 creates the schema AutoMigrate used to create, tables and indexes
+-- that already exist are kept so databases created by it can be adopted
+
+CREATE TABLE IF NOT EXISTS "users" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	"deleted_at" timestamptz,
+	"username" text,
+	"password" text,
+	"name" text,
+	"email" text,
+	"verified_at" timestamptz,
+	"role" varchar(20) DEFAULT 'user',
+	"totp_secret" varchar(64),
+	"totp_enabled" boolean,
+	"totp_last_step" bigint,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "posts" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	"deleted_at" timestamptz,
+	"user_id" bigint,
+	"content" text,
+	"likes" bigint,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "fk_posts_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_posts_deleted_at" ON "posts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"user_id" bigint,
+	"hash" varchar(64),
+	"used_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"user_id" bigint,
+	"name" varchar(100),
+	"prefix" varchar(20),
+	"hash" varchar(64),
+	"scopes" varchar(255),
+	"last_used_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_hash" ON "api_keys" ("hash");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "identities" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"user_id" bigint,
+	"provider" varchar(50),
+	"subject" varchar(255),
+	"email" text,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_identity_subject" ON "identities" ("provider","subject");
+CREATE INDEX IF NOT EXISTS "idx_identities_user_id" ON "identities" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "o_auth_clients" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"owner_id" bigint,
+	"client_id" varchar(64),
+	"secret_hash" varchar(64),
+	"name" varchar(100),
+	"redirect_uris" varchar(1000),
+	"scopes" varchar(255),
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_o_auth_clients_client_id" ON "o_auth_clients" ("client_id");
+CREATE INDEX IF NOT EXISTS "idx_o_auth_clients_owner_id" ON "o_auth_clients" ("owner_id");
+
+CREATE TABLE IF NOT EXISTS "o_auth_tokens" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"client_id" varchar(64),
+	"user_id" bigint,
+	"scopes" varchar(255),
+	"access_hash" varchar(64),
+	"access_expires_at" timestamptz,
+	"refresh_hash" varchar(64),
+	"refresh_expires_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_o_auth_tokens_access_hash" ON "o_auth_tokens" ("access_hash");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_o_auth_tokens_refresh_hash" ON "o_auth_tokens" ("refresh_hash");
+CREATE INDEX IF NOT EXISTS "idx_o_auth_tokens_client_id" ON "o_auth_tokens" ("client_id");
+CREATE INDEX IF NOT EXISTS "idx_o_auth_tokens_user_id" ON "o_auth_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "audit_events" (
+	"id" bigserial,
+	"created_at" timestamptz,
+	"actor_id" varchar(20),
+	"actor" varchar(100),
+	"action" varchar(50),
+	"target_type" varchar(20),
+	"target_id" varchar(50),
+	"outcome" varchar(10),
+	"detail" varchar(255),
+	"ip" varchar(45),
+	"user_agent" varchar(255),
+	"request_id" varchar(128),
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_events_created_at" ON "audit_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_action" ON "audit_events" ("action");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_target_id" ON "audit_events" ("target_id");
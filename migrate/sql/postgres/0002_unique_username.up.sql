@@ -0,0 +1,4 @@
+-- 0002 makes usernames unique, logins look users up by username
+
+ALTER TABLE "users" ALTER COLUMN "username" TYPE varchar(100);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
@@ -0,0 +1,120 @@
+-- 0001 creates the schema AutoMigrate used to create, tables and indexes
+-- that already exist are kept so databases created by it can be adopted
+
+CREATE TABLE IF NOT EXISTS `users` (
+	`id` integer,
+	`created_at` datetime,
+	`updated_at` datetime,
+	`deleted_at` datetime,
+	`username` text,
+	`password` text,
+	`name` text,
+	`email` text,
+	`verified_at` datetime,
+	`role` text DEFAULT 'user',
+	`totp_secret` text,
+	`totp_enabled` numeric,
+	`totp_last_step` integer,
+	PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `posts` (
+	`id` integer,
+	`created_at` datetime,
+	`updated_at` datetime,
+	`deleted_at` datetime,
+	`user_id` integer,
+	`content` text,
+	`likes` integer,
+	PRIMARY KEY (`id`),
+	CONSTRAINT `fk_posts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_posts_deleted_at` ON `posts` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+	`id` integer,
+	`created_at` datetime,
+	`user_id` integer,
+	`hash` text,
+	`used_at` datetime,
+	PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `api_keys` (
+	`id` integer,
+	`created_at` datetime,
+	`user_id` integer,
+	`name` text,
+	`prefix` text,
+	`hash` text,
+	`scopes` text,
+	`last_used_at` datetime,
+	PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_keys_hash` ON `api_keys` (`hash`);
+CREATE INDEX IF NOT EXISTS `idx_api_keys_user_id` ON `api_keys` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `identities` (
+	`id` integer,
+	`created_at` datetime,
+	`user_id` integer,
+	`provider` text,
+	`subject` text,
+	`email` text,
+	PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_identity_subject` ON `identities` (`provider`,`subject`);
+CREATE INDEX IF NOT EXISTS `idx_identities_user_id` ON `identities` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `o_auth_clients` (
+	`id` integer,
+	`created_at` datetime,
+	`owner_id` integer,
+	`client_id` text,
+	`secret_hash` text,
+	`name` text,
+	`redirect_uris` text,
+	`scopes` text,
+	PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_o_auth_clients_client_id` ON `o_auth_clients` (`client_id`);
+CREATE INDEX IF NOT EXISTS `idx_o_auth_clients_owner_id` ON `o_auth_clients` (`owner_id`);
+
+CREATE TABLE IF NOT EXISTS `o_auth_tokens` (
+	`id` integer,
+	`created_at` datetime,
+	`client_id` text,
+	`user_id` integer,
+	`scopes` text,
+	`access_hash` text,
+	`access_expires_at` datetime,
+	`refresh_hash` text,
+	`refresh_expires_at` datetime,
+	PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_o_auth_tokens_access_hash` ON `o_auth_tokens` (`access_hash`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_o_auth_tokens_refresh_hash` ON `o_auth_tokens` (`refresh_hash`);
+CREATE INDEX IF NOT EXISTS `idx_o_auth_tokens_client_id` ON `o_auth_tokens` (`client_id`);
+CREATE INDEX IF NOT EXISTS `idx_o_auth_tokens_user_id` ON `o_auth_tokens` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `audit_events` (
+	`id` integer,
+	`created_at` datetime,
+	`actor_id` text,
+	`actor` text,
+	`action` text,
+	`target_type` text,
+	`target_id` text,
+	`outcome` text,
+	`detail` text,
+	`ip` text,
+	`user_agent` text,
+	`request_id` text,
+	PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_created_at` ON `audit_events` (`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_actor_id` ON `audit_events` (`actor_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_action` ON `audit_events` (`action`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_target_id` ON `audit_events` (`target_id`);
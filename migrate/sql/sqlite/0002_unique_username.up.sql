@@ -0,0 +1,3 @@
+-- 0002 makes usernames unique, logins look users up by username
+
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_username` ON `users` (`username`);
@@ -0,0 +1,10 @@
+-- posts references users so it goes first
+
+DROP TABLE "audit_events";
+DROP TABLE "o_auth_tokens";
+DROP TABLE "o_auth_clients";
+DROP TABLE "identities";
+DROP TABLE "api_keys";
+DROP TABLE "recovery_codes";
+DROP TABLE "posts";
+DROP TABLE "users";
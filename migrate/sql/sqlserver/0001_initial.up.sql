@@ -0,0 +1,120 @@
+-- 0001 creates the schema AutoMigrate used to create, tables and indexes
+-- that already exist are kept so databases created by it can be adopted
+
+IF OBJECT_ID(N'users', N'U') IS NULL CREATE TABLE "users" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"updated_at" datetimeoffset,
+	"deleted_at" datetimeoffset,
+	"username" nvarchar(MAX),
+	"password" nvarchar(MAX),
+	"name" nvarchar(MAX),
+	"email" nvarchar(MAX),
+	"verified_at" datetimeoffset,
+	"role" nvarchar(20) DEFAULT 'user',
+	"totp_secret" nvarchar(64),
+	"totp_enabled" bit,
+	"totp_last_step" bigint,
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_users_deleted_at') CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+
+IF OBJECT_ID(N'posts', N'U') IS NULL CREATE TABLE "posts" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"updated_at" datetimeoffset,
+	"deleted_at" datetimeoffset,
+	"user_id" bigint,
+	"content" nvarchar(MAX),
+	"likes" bigint,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "fk_posts_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_posts_deleted_at') CREATE INDEX "idx_posts_deleted_at" ON "posts" ("deleted_at");
+
+IF OBJECT_ID(N'recovery_codes', N'U') IS NULL CREATE TABLE "recovery_codes" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"user_id" bigint,
+	"hash" nvarchar(64),
+	"used_at" datetimeoffset,
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_recovery_codes_user_id') CREATE INDEX "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+IF OBJECT_ID(N'api_keys', N'U') IS NULL CREATE TABLE "api_keys" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"user_id" bigint,
+	"name" nvarchar(100),
+	"prefix" nvarchar(20),
+	"hash" nvarchar(64),
+	"scopes" nvarchar(255),
+	"last_used_at" datetimeoffset,
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_api_keys_hash') CREATE UNIQUE INDEX "idx_api_keys_hash" ON "api_keys" ("hash");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_api_keys_user_id') CREATE INDEX "idx_api_keys_user_id" ON "api_keys" ("user_id");
+
+IF OBJECT_ID(N'identities', N'U') IS NULL CREATE TABLE "identities" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"user_id" bigint,
+	"provider" nvarchar(50),
+	"subject" nvarchar(255),
+	"email" nvarchar(MAX),
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_identity_subject') CREATE UNIQUE INDEX "idx_identity_subject" ON "identities" ("provider","subject");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_identities_user_id') CREATE INDEX "idx_identities_user_id" ON "identities" ("user_id");
+
+IF OBJECT_ID(N'o_auth_clients', N'U') IS NULL CREATE TABLE "o_auth_clients" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"owner_id" bigint,
+	"client_id" nvarchar(64),
+	"secret_hash" nvarchar(64),
+	"name" nvarchar(100),
+	"redirect_uris" nvarchar(1000),
+	"scopes" nvarchar(255),
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_clients_client_id') CREATE UNIQUE INDEX "idx_o_auth_clients_client_id" ON "o_auth_clients" ("client_id");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_clients_owner_id') CREATE INDEX "idx_o_auth_clients_owner_id" ON "o_auth_clients" ("owner_id");
+
+IF OBJECT_ID(N'o_auth_tokens', N'U') IS NULL CREATE TABLE "o_auth_tokens" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"client_id" nvarchar(64),
+	"user_id" bigint,
+	"scopes" nvarchar(255),
+	"access_hash" nvarchar(64),
+	"access_expires_at" datetimeoffset,
+	"refresh_hash" nvarchar(64),
+	"refresh_expires_at" datetimeoffset,
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_tokens_access_hash') CREATE UNIQUE INDEX "idx_o_auth_tokens_access_hash" ON "o_auth_tokens" ("access_hash");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_tokens_refresh_hash') CREATE UNIQUE INDEX "idx_o_auth_tokens_refresh_hash" ON "o_auth_tokens" ("refresh_hash");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_tokens_client_id') CREATE INDEX "idx_o_auth_tokens_client_id" ON "o_auth_tokens" ("client_id");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_o_auth_tokens_user_id') CREATE INDEX "idx_o_auth_tokens_user_id" ON "o_auth_tokens" ("user_id");
+
+IF OBJECT_ID(N'audit_events', N'U') IS NULL CREATE TABLE "audit_events" (
+	"id" bigint IDENTITY(1,1),
+	"created_at" datetimeoffset,
+	"actor_id" nvarchar(20),
+	"actor" nvarchar(100),
+	"action" nvarchar(50),
+	"target_type" nvarchar(20),
+	"target_id" nvarchar(50),
+	"outcome" nvarchar(10),
+	"detail" nvarchar(255),
+	"ip" nvarchar(45),
+	"user_agent" nvarchar(255),
+	"request_id" nvarchar(128),
+	PRIMARY KEY ("id")
+);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_audit_events_created_at') CREATE INDEX "idx_audit_events_created_at" ON "audit_events" ("created_at");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_audit_events_actor_id') CREATE INDEX "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_audit_events_action') CREATE INDEX "idx_audit_events_action" ON "audit_events" ("action");
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_audit_events_target_id') CREATE INDEX "idx_audit_events_target_id" ON "audit_events" ("target_id");
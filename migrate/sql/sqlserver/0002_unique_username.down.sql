@@ -0,0 +1,2 @@
+IF EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_users_username') DROP INDEX "idx_users_username" ON "users";
+ALTER TABLE "users" ALTER COLUMN "username" nvarchar(MAX);
@@ -0,0 +1,5 @@
+-- 0002 makes usernames unique, logins look users up by username.
+-- nvarchar(MAX) can't be indexed so the column is shortened first.
+
+ALTER TABLE "users" ALTER COLUMN "username" nvarchar(100);
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = N'idx_users_username') CREATE UNIQUE INDEX "idx_users_username" ON "users" ("username");
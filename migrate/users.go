@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// goMigrations are the migrations written in Go, shared by every driver
+var goMigrations = []Migration{
+	{Version: 3, Name: "user_columns", UpFunc: addUserColumns},
+}
+
+// baselineUser is the users table as of migration 0001. Tables created
+// before migrations were introduced lack the columns added since, as 0001
+// keeps an existing table as it is.
+type baselineUser struct {
+	VerifiedAt   *time.Time
+	Role         string `gorm:"size:20;default:user"`
+	TOTPSecret   string `gorm:"size:64"`
+	TOTPEnabled  bool
+	TOTPLastStep int64
+}
+
+func (baselineUser) TableName() string {
+	return "users"
+}
+
+// addUserColumns adds the columns of 0001 the users table lacks and sets
+// them for the existing rows. It has no down step, as on a table created by
+// 0001 the columns belong to it.
+func addUserColumns(tx *gorm.DB) error {
+	columns := []struct {
+		field string
+		name  string
+		value interface{}
+	}{
+		{"VerifiedAt", "verified_at", nil},
+		{"Role", "role", "user"},
+		{"TOTPSecret", "totp_secret", ""},
+		{"TOTPEnabled", "totp_enabled", false},
+		{"TOTPLastStep", "totp_last_step", 0},
+	}
+	m := tx.Migrator()
+	for _, c := range columns {
+		if m.HasColumn(&baselineUser{}, c.field) {
+			continue
+		}
+		if err := m.AddColumn(&baselineUser{}, c.field); err != nil {
+			return err
+		}
+		if c.value == nil {
+			continue
+		}
+		err := tx.Table("users").Where(c.name+" IS NULL").Update(c.name, c.value).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+// authorize follows the authorization url and returns the code and state
+// the mock provider redirected back with
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect but got %d", res.StatusCode)
+	}
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	srv := oidctest.NewServer(oidctest.User{Subject: "42", Email: "alice@example.com", EmailVerified: true, Username: "alice"})
+	defer srv.Close()
+
+	p, err := oidc.Discover(ctx, srv.Config("mock", "http://localhost/oidc/mock/callback"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	state, _ := oidc.NewState()
+	nonce, _ := oidc.NewState()
+	verifier, _ := oidc.NewVerifier()
+	code, returnedState := authorize(t, p.AuthCodeURL(state, nonce, verifier))
+	assert.Equal(t, state, returnedState)
+
+	claims, err := p.Exchange(ctx, code, verifier, nonce)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "42", claims.Subject)
+		assert.Equal(t, "alice@example.com", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, "alice", claims.PreferredUsername)
+	}
+
+	// codes are single use
+	_, err = p.Exchange(ctx, code, verifier, nonce)
+	assert.Equal(t, oidc.ErrExchange, err)
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	ctx := context.Background()
+	srv := oidctest.NewServer(oidctest.User{Subject: "42"})
+	defer srv.Close()
+
+	p, err := oidc.Discover(ctx, srv.Config("mock", "http://localhost/oidc/mock/callback"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	verifier, _ := oidc.NewVerifier()
+	other, _ := oidc.NewVerifier()
+	code, _ := authorize(t, p.AuthCodeURL("state", "nonce", verifier))
+	_, err = p.Exchange(ctx, code, other, "nonce")
+	assert.Equal(t, oidc.ErrExchange, err)
+
+	code, _ = authorize(t, p.AuthCodeURL("state", "nonce", verifier))
+	_, err = p.Exchange(ctx, code, verifier, "other nonce")
+	assert.Equal(t, oidc.ErrInvalidIDToken, err)
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer(oidctest.User{Subject: "42"})
+	defer srv.Close()
+
+	cfg := srv.Config("mock", "http://localhost/oidc/mock/callback")
+	cfg.Issuer += "/"
+	_, err := oidc.Discover(context.Background(), cfg, nil)
+	assert.Error(t, err)
+}
+
+func TestChallenge(t *testing.T) {
+	// base64url without padding of the sha256 of the verifier
+	assert.Equal(t, "cSfIWt-utuJ-CeQCn2Emkv_TW8zx6SDFp8ywsfevvpc", oidc.Challenge("dBjftJeZ4CVP-mB92K-uhaMdW7YqOFztXWk8Ebp0H2k"))
+}
@@ -0,0 +1,203 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// supported hashing algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// default argon2id parameters, taken from the RFC 9106 second recommendation
+const (
+	defaultArgon2Time    = 3
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 4
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// ErrInvalidHash is returned when a stored hash can't be decoded
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Hasher hashes and verifies user passwords.
+// The zero value hashes with bcrypt at the default cost.
+type Hasher struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // in KiB
+	Argon2Threads uint8
+}
+
+// Hash returns the encoded hash of the plain text password
+func (h Hasher) Hash(plain string) (string, error) {
+	switch h.algorithm() {
+	case Bcrypt:
+		b, err := bcrypt.GenerateFromPassword([]byte(plain), h.bcryptCost())
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case Argon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		p := h.argon2Params()
+		key := argon2.IDKey([]byte(plain), salt, p.time, p.memory, p.threads, argon2KeyLen)
+		return p.encode(salt, key), nil
+	}
+	return "", fmt.Errorf("unsupported password algorithm %q", h.Algorithm)
+}
+
+// Verify compares the plain text password against the stored value.
+// rehash reports whether the stored value should be replaced by a fresh
+// Hash, either because it was made with other parameters or because it is
+// a legacy plain text password.
+func (h Hasher) Verify(stored, plain string) (ok bool, rehash bool, err error) {
+	switch {
+	case isBcrypt(stored):
+		if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		if h.algorithm() != Bcrypt {
+			return true, true, nil
+		}
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return false, false, err
+		}
+		return true, cost != h.bcryptCost(), nil
+	case strings.HasPrefix(stored, "$argon2id$"):
+		p, salt, key, err := decodeArgon2(stored)
+		if err != nil {
+			return false, false, err
+		}
+		other := argon2.IDKey([]byte(plain), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+		return true, h.algorithm() != Argon2id || p != h.argon2Params(), nil
+	}
+
+	// legacy rows store the password as plain text
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) != 1 {
+		return false, false, nil
+	}
+	return true, true, nil
+}
+
+// dummies caches the dummy hash of every Hasher configuration
+var dummies sync.Map
+
+// VerifyDummy verifies the password against a fixed hash made with the
+// same parameters and discards the result. Logins of unknown users call
+// it so they take as long as those of existing users.
+func (h Hasher) VerifyDummy(plain string) error {
+	dummy, ok := dummies.Load(h)
+	if !ok {
+		hash, err := h.Hash("dummy password")
+		if err != nil {
+			return err
+		}
+		dummy, _ = dummies.LoadOrStore(h, hash)
+	}
+	_, _, err := h.Verify(dummy.(string), plain)
+	return err
+}
+
+func (h Hasher) algorithm() string {
+	if h.Algorithm == "" {
+		return Bcrypt
+	}
+	return h.Algorithm
+}
+
+func (h Hasher) bcryptCost() int {
+	if h.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.BcryptCost
+}
+
+func (h Hasher) argon2Params() argon2Params {
+	p := argon2Params{
+		time:    h.Argon2Time,
+		memory:  h.Argon2Memory,
+		threads: h.Argon2Threads,
+	}
+	if p.time == 0 {
+		p.time = defaultArgon2Time
+	}
+	if p.memory == 0 {
+		p.memory = defaultArgon2Memory
+	}
+	if p.threads == 0 {
+		p.threads = defaultArgon2Threads
+	}
+	return p
+}
+
+func isBcrypt(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// encode formats the hash the same way as the reference implementation
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(stored string) (argon2Params, []byte, []byte, error) {
+	p := argon2Params{}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	return p, salt, key, nil
+}
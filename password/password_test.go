@@ -0,0 +1,97 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/social-gin/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerifyBcrypt(t *testing.T) {
+	h := password.Hasher{BcryptCost: 4}
+
+	hash, err := h.Hash("1234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(hash, "$2a$"))
+
+	ok, rehash, err := h.Verify(hash, "1234567890")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = h.Verify(hash, "wrong")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHashAndVerifyArgon2id(t *testing.T) {
+	h := password.Hasher{Algorithm: password.Argon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+	hash, err := h.Hash("1234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, rehash, err := h.Verify(hash, "1234567890")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = h.Verify(hash, "wrong")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyRehashWhenParametersChange(t *testing.T) {
+	old := password.Hasher{BcryptCost: 4}
+	hash, err := old.Hash("1234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, rehash, err := password.Hasher{BcryptCost: 5}.Verify(hash, "1234567890")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	argon := password.Hasher{Algorithm: password.Argon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+	ok, rehash, err = argon.Verify(hash, "1234567890")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestVerifyLegacyPlainText(t *testing.T) {
+	h := password.Hasher{}
+
+	ok, rehash, err := h.Verify("1234567890", "1234567890")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, rehash, err = h.Verify("1234567890", "123456789")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestVerifyInvalidArgon2Hash(t *testing.T) {
+	_, _, err := password.Hasher{}.Verify("$argon2id$v=19$broken", "1234567890")
+	assert.Equal(t, password.ErrInvalidHash, err)
+}
+
+func TestVerifyDummy(t *testing.T) {
+	for _, h := range []password.Hasher{
+		{BcryptCost: 4},
+		{Algorithm: password.Argon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1},
+	} {
+		// the second call reuses the cached hash
+		assert.NoError(t, h.VerifyDummy("1234567890"))
+		assert.NoError(t, h.VerifyDummy("dummy password"))
+	}
+	assert.Error(t, password.Hasher{Algorithm: "md5"}.VerifyDummy("1234567890"))
+}
@@ -0,0 +1,49 @@
+package post
+
+import (
+	"time"
+
+	"example.com/social-gin/user"
+)
+
+// PostRequest represents add post request body
+type PostRequest struct {
+	Content string `json:"content" binding:"required,max=1000"`
+	Likes   int    `json:"likes" binding:"min=0"`
+}
+
+// UpdatePostRequest represents update post request body,
+// empty fields are left unchanged
+type UpdatePostRequest struct {
+	Content string `json:"content" binding:"max=1000"`
+	Likes   int    `json:"likes" binding:"min=0"`
+}
+
+// PostResponse represents post returned to the client,
+// the author is only exposed through its public profile
+type PostResponse struct {
+	ID        uint             `json:"id"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"update_at"`
+	UserID    int              `json:"user_id"`
+	Author    *user.PublicUser `json:"author,omitempty"`
+	Content   string           `json:"content"`
+	Likes     int              `json:"likes"`
+}
+
+// Response returns response representation of the post
+func (p Post) Response() PostResponse {
+	resp := PostResponse{
+		ID:        p.ID,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		UserID:    p.UserID,
+		Content:   p.Content,
+		Likes:     p.Likes,
+	}
+	if p.User.ID != 0 {
+		author := p.User.Public()
+		resp.Author = &author
+	}
+	return resp
+}
@@ -2,14 +2,15 @@ package post
 
 import (
 	"database/sql"
-	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
 	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // Post represents user post
@@ -24,126 +25,103 @@ type Post struct {
 	Likes     int          `json:"likes"`
 }
 
+// errors of post handlers
+var (
+	errInvalidPostID = apperror.BadRequest(apperror.CodeInvalidParam, "invalid post id")
+	ErrPostNotFound  = apperror.NotFound("post_not_found", "post not found")
+)
+
 // Handler handles user requests
 type Handler struct {
-	DB *gorm.DB
+	Posts PostRepository
+	Audit *audit.Log
 }
 
 // AddPost handle add post request
 func (h *Handler) AddPost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, user.ErrInvalidUserID)
 		return
 	}
-	post := Post{}
-
-	if err := c.Bind(&post); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	req := PostRequest{}
+	if !validation.Bind(c, &req) {
 		return
 	}
 
-	post.UserID = uid
+	post := Post{
+		UserID:  uid,
+		Content: req.Content,
+		Likes:   req.Likes,
+	}
 
-	if result := h.DB.Create(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.Posts.Create(c.Request.Context(), &post); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, post)
+	h.record(c, audit.ActionPostCreate, post)
+	c.JSON(http.StatusOK, post.Response())
 }
 
 // ListPost handle list post request
 func (h *Handler) ListPost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, user.ErrInvalidUserID)
 		return
 	}
-	posts := []Post{}
-	if result := h.DB.Where("user_id = ?", uid).Find(&posts); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	posts, err := h.Posts.ListByUser(c.Request.Context(), uid)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, posts)
+	resp := make([]PostResponse, 0, len(posts))
+	for _, p := range posts {
+		resp = append(resp, p.Response())
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetPost handle get post request
 func (h *Handler) GetPost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, user.ErrInvalidUserID)
 		return
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, errInvalidPostID)
 		return
 	}
-	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	post, err := h.Posts.Get(c.Request.Context(), uid, pid)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, post)
+	c.JSON(http.StatusOK, post.Response())
 }
 
 // UpdatePost handle update post request
 func (h *Handler) UpdatePost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, user.ErrInvalidUserID)
 		return
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, errInvalidPostID)
 		return
 	}
-	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	post, err := h.Posts.Get(c.Request.Context(), uid, pid)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	updatePost := Post{}
-	if err := c.Bind(&updatePost); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	updatePost := UpdatePostRequest{}
+	if !validation.Bind(c, &updatePost) {
 		return
 	}
 
@@ -155,51 +133,46 @@ func (h *Handler) UpdatePost(c *gin.Context) {
 		post.Likes = updatePost.Likes
 	}
 
-	if result := h.DB.Save(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.Posts.Save(c.Request.Context(), &post); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	h.record(c, audit.ActionPostUpdate, post)
+	c.JSON(http.StatusOK, post.Response())
 }
 
 // DeletePost handle delete post request
 func (h *Handler) DeletePost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, user.ErrInvalidUserID)
 		return
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, errInvalidPostID)
 		return
 	}
-	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	post, err := h.Posts.Get(c.Request.Context(), uid, pid)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result := h.DB.Delete(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.Posts.Delete(c.Request.Context(), &post); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, post)
+	h.record(c, audit.ActionPostDelete, post)
+	c.JSON(http.StatusOK, post.Response())
+}
+
+// record writes a change of the post to the audit log
+func (h *Handler) record(c *gin.Context, action string, p Post) {
+	h.Audit.Record(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetPost,
+		TargetID:   strconv.Itoa(int(p.ID)),
+	})
 }
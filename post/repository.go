@@ -0,0 +1,56 @@
+package post
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// PostRepository stores posts. Posts are returned with their author,
+// lookups return ErrPostNotFound when no post matches.
+type PostRepository interface {
+	Create(ctx context.Context, p *Post) error
+	ListByUser(ctx context.Context, uid int) ([]Post, error)
+	// Get returns the post pid of the user uid
+	Get(ctx context.Context, uid int, pid int) (Post, error)
+	Save(ctx context.Context, p *Post) error
+	Delete(ctx context.Context, p *Post) error
+}
+
+// GormRepository keeps posts in the database
+type GormRepository struct {
+	DB *gorm.DB
+}
+
+// Create inserts the post and sets its id
+func (r *GormRepository) Create(ctx context.Context, p *Post) error {
+	return r.DB.WithContext(ctx).Create(p).Error
+}
+
+// ListByUser returns the posts of the user
+func (r *GormRepository) ListByUser(ctx context.Context, uid int) ([]Post, error) {
+	posts := []Post{}
+	err := r.DB.WithContext(ctx).Preload("User").Where("user_id = ?", uid).Find(&posts).Error
+	return posts, err
+}
+
+// Get returns the post pid of the user uid
+func (r *GormRepository) Get(ctx context.Context, uid int, pid int) (Post, error) {
+	p := Post{}
+	err := r.DB.WithContext(ctx).Preload("User").Where("user_id = ? and id = ?", uid, pid).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return p, ErrPostNotFound
+	}
+	return p, err
+}
+
+// Save writes every field of the post
+func (r *GormRepository) Save(ctx context.Context, p *Post) error {
+	return r.DB.WithContext(ctx).Omit("User").Save(p).Error
+}
+
+// Delete soft deletes the post
+func (r *GormRepository) Delete(ctx context.Context, p *Post) error {
+	return r.DB.WithContext(ctx).Delete(p).Error
+}
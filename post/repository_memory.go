@@ -0,0 +1,120 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/social-gin/user"
+)
+
+// MemoryRepository keeps posts in process memory. It is meant for tests,
+// posts are lost on restart.
+type MemoryRepository struct {
+	// Users resolves authors of posts, posts have no author when nil
+	Users user.UserRepository
+
+	mu     sync.Mutex
+	posts  map[uint]Post
+	nextID uint
+}
+
+// NewMemoryRepository creates empty in-memory post repository, authors
+// are looked up in users
+func NewMemoryRepository(users user.UserRepository) *MemoryRepository {
+	return &MemoryRepository{
+		Users:  users,
+		posts:  map[uint]Post{},
+		nextID: 1,
+	}
+}
+
+// Create inserts the post and sets its id
+func (m *MemoryRepository) Create(ctx context.Context, p *Post) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.ID = m.nextID
+	m.nextID++
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	stored := *p
+	stored.User = user.User{}
+	m.posts[p.ID] = stored
+	return nil
+}
+
+// ListByUser returns the posts of the user ordered by id
+func (m *MemoryRepository) ListByUser(ctx context.Context, uid int) ([]Post, error) {
+	m.mu.Lock()
+	posts := []Post{}
+	for _, p := range m.posts {
+		if p.UserID == uid {
+			posts = append(posts, p)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].ID < posts[j].ID
+	})
+	for i := range posts {
+		if err := m.withAuthor(ctx, &posts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+// Get returns the post pid of the user uid
+func (m *MemoryRepository) Get(ctx context.Context, uid int, pid int) (Post, error) {
+	m.mu.Lock()
+	p, ok := m.posts[uint(pid)]
+	m.mu.Unlock()
+
+	if !ok || p.UserID != uid {
+		return Post{}, ErrPostNotFound
+	}
+	return p, m.withAuthor(ctx, &p)
+}
+
+// withAuthor sets the author of the post, as Preload does for posts of
+// deleted users it leaves it empty
+func (m *MemoryRepository) withAuthor(ctx context.Context, p *Post) error {
+	if m.Users == nil {
+		return nil
+	}
+	u, err := m.Users.Get(ctx, uint(p.UserID))
+	if errors.Is(err, user.ErrUserNotFound) {
+		return nil
+	}
+	p.User = u
+	return err
+}
+
+// Save writes every field of the post
+func (m *MemoryRepository) Save(ctx context.Context, p *Post) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.posts[p.ID]; !ok {
+		return ErrPostNotFound
+	}
+	p.UpdatedAt = time.Now()
+	stored := *p
+	stored.User = user.User{}
+	m.posts[p.ID] = stored
+	return nil
+}
+
+// Delete removes the post
+func (m *MemoryRepository) Delete(ctx context.Context, p *Post) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.posts, p.ID)
+	return nil
+}
@@ -0,0 +1,87 @@
+package rbac
+
+// roles of a user
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// permissions checked by routes, "any" permissions allow acting on
+// resources owned by other users
+const (
+	UserReadAny          = "user:read:any"
+	UserUpdateAny        = "user:update:any"
+	UserDeleteAny        = "user:delete:any"
+	UserRoleUpdate       = "user:role:update"
+	UserUnlock           = "user:unlock"
+	PostCreateAny        = "post:create:any"
+	PostUpdateAny        = "post:update:any"
+	PostDeleteAny        = "post:delete:any"
+	SessionManageAny     = "session:manage:any"
+	APIKeyManageAny      = "apikey:manage:any"
+	OAuthClientManageAny = "oauthclient:manage:any"
+	TableListAny         = "table:list:any"
+	AuditRead            = "audit:read"
+)
+
+// scopes limit what a delegated credential such as an API key may do on
+// behalf of its user, on top of the user's role
+const (
+	ScopeProfileRead = "profile:read"
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+	ScopePostsWrite  = "posts:write"
+	ScopeSessions    = "sessions"
+	// ScopeAccount guards credentials and second factors, it is never
+	// granted so those can only be changed from a real login
+	ScopeAccount = "account"
+)
+
+// grantable scopes of delegated credentials
+var scopes = []string{ScopeProfileRead, ScopeUsersRead, ScopeUsersWrite, ScopePostsWrite, ScopeSessions}
+
+// Scopes returns the scopes that may be granted to delegated credentials
+func Scopes() []string {
+	return append([]string{}, scopes...)
+}
+
+// ValidScope reports whether scope may be granted to delegated credentials
+func ValidScope(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// all grants every permission
+const all = "*"
+
+// permissions granted to each role
+var permissions = map[string][]string{
+	RoleUser:      {},
+	RoleModerator: {UserReadAny, PostDeleteAny},
+	RoleAdmin:     {all},
+}
+
+// Valid reports whether role is a known role
+func Valid(role string) bool {
+	_, ok := permissions[role]
+	return ok
+}
+
+// Can reports whether role is granted the permission,
+// an empty role is treated as a plain user
+func Can(role string, permission string) bool {
+	if role == "" {
+		role = RoleUser
+	}
+	for _, p := range permissions[role] {
+		if p == all || p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package rbac_test
+
+import (
+	"testing"
+
+	"example.com/social-gin/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	assert.False(t, rbac.Can(rbac.RoleUser, rbac.PostDeleteAny))
+	assert.False(t, rbac.Can("", rbac.PostDeleteAny))
+	assert.True(t, rbac.Can(rbac.RoleModerator, rbac.PostDeleteAny))
+	assert.False(t, rbac.Can(rbac.RoleModerator, rbac.UserRoleUpdate))
+	assert.True(t, rbac.Can(rbac.RoleAdmin, rbac.UserRoleUpdate))
+	assert.False(t, rbac.Can("root", rbac.UserRoleUpdate))
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, rbac.Valid(rbac.RoleAdmin))
+	assert.False(t, rbac.Valid("root"))
+}
+
+func TestValidScope(t *testing.T) {
+	assert.True(t, rbac.ValidScope(rbac.ScopePostsWrite))
+	assert.False(t, rbac.ValidScope(rbac.ScopeAccount))
+	assert.False(t, rbac.ValidScope("posts:delete"))
+}
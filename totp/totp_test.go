@@ -0,0 +1,72 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 4226 appendix D
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		assert.Equal(t, code, totp.HOTP(key, uint64(counter), 6))
+	}
+}
+
+// RFC 6238 appendix B, SHA1 column
+func TestTOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, code := range tests {
+		step := totp.Step(time.Unix(unix, 0))
+		assert.Equal(t, code, totp.HOTP(key, uint64(step), 8))
+	}
+
+	secret := base32.StdEncoding.EncodeToString(key)
+	code, err := totp.Code(secret, time.Unix(59, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+}
+
+func TestValidateSkewAndReplay(t *testing.T) {
+	secret, err := totp.NewSecret()
+	assert.NoError(t, err)
+	now := time.Now()
+
+	previous, _ := totp.Code(secret, now.Add(-totp.Period))
+	step, ok, err := totp.Validate(secret, previous, now, 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	// the same code can't be used twice
+	_, ok, _ = totp.Validate(secret, previous, now, step)
+	assert.False(t, ok)
+
+	tooOld, _ := totp.Code(secret, now.Add(-3*totp.Period))
+	_, ok, _ = totp.Validate(secret, tooOld, now, 0)
+	assert.False(t, ok)
+
+	_, _, err = totp.Validate("not base32!", "123456", now, 0)
+	assert.Equal(t, totp.ErrInvalidSecret, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("social-gin", "sert4", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/social-gin:sert4?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=social-gin")
+}
@@ -0,0 +1,80 @@
+package user
+
+import (
+	"strconv"
+	"time"
+
+	"example.com/social-gin/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUserRequest represents add user request body
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,username"`
+	Password string `json:"password" binding:"required,password"`
+	Name     string `json:"name" binding:"max=100"`
+	Email    string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+// UpdateUserRequest represents update user request body,
+// empty fields are left unchanged
+type UpdateUserRequest struct {
+	Username string `json:"username" binding:"omitempty,username"`
+	Password string `json:"password" binding:"omitempty,password"`
+	Name     string `json:"name" binding:"max=100"`
+	Email    string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+// UpdateRoleRequest represents update user role request body
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// PublicUser represents user profile visible to everyone
+type PublicUser struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+}
+
+// PrivateUser represents user profile visible only to its owner
+type PrivateUser struct {
+	PublicUser
+	UpdatedAt  time.Time  `json:"update_at"`
+	Email      string     `json:"email"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	Role       string     `json:"role"`
+	TwoFactor  bool       `json:"two_factor"`
+}
+
+// Public returns public profile of the user
+func (u User) Public() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		Username:  u.Username,
+		Name:      u.Name,
+	}
+}
+
+// Private returns private profile of the user
+func (u User) Private() PrivateUser {
+	return PrivateUser{
+		PublicUser: u.Public(),
+		UpdatedAt:  u.UpdatedAt,
+		Email:      u.Email,
+		VerifiedAt: u.VerifiedAt,
+		TwoFactor:  u.TOTPEnabled,
+		Role:       u.Role,
+	}
+}
+
+// Profile returns private profile when the authenticated user owns u or
+// may read any user, otherwise public profile
+func Profile(c *gin.Context, u User) interface{} {
+	if c.GetString("uid") == strconv.Itoa(int(u.ID)) || rbac.Can(c.GetString("role"), rbac.UserReadAny) {
+		return u.Private()
+	}
+	return u.Public()
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/social-gin/database"
+	"gorm.io/gorm"
+)
+
+// UserRepository stores users. Lookups return ErrUserNotFound when no
+// user matches, writes return ErrUsernameTaken when another user has the
+// username.
+type UserRepository interface {
+	Create(ctx context.Context, u *User) error
+	List(ctx context.Context) ([]User, error)
+	Get(ctx context.Context, id uint) (User, error)
+	FindByUsername(ctx context.Context, username string) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	// Save writes every field of the user
+	Save(ctx context.Context, u *User) error
+	// Update writes only the named fields of the user, so concurrent
+	// changes to the others are kept
+	Update(ctx context.Context, u *User, fields ...string) error
+	// MarkVerified sets the email of the user as verified, unless it was
+	// changed since the verification was sent
+	MarkVerified(ctx context.Context, id uint, email string) error
+	// AdvanceTOTPStep records the TOTP step as used, false when the step
+	// or a later one was used already
+	AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
+	Delete(ctx context.Context, u *User) error
+	// WithinTx runs fn as one unit of work, the writes made with the
+	// context passed to fn are undone when fn returns an error
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// GormRepository keeps users in the database
+type GormRepository struct {
+	DB *gorm.DB
+}
+
+// Create inserts the user and sets its id
+func (r *GormRepository) Create(ctx context.Context, u *User) error {
+	return writeError(r.conn(ctx).Create(u).Error)
+}
+
+// List returns every user
+func (r *GormRepository) List(ctx context.Context) ([]User, error) {
+	users := []User{}
+	err := r.conn(ctx).Find(&users).Error
+	return users, err
+}
+
+// Get returns the user by id
+func (r *GormRepository) Get(ctx context.Context, id uint) (User, error) {
+	return r.first(r.conn(ctx).Where("id = ?", id))
+}
+
+// FindByUsername returns the user by username
+func (r *GormRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	return r.first(r.conn(ctx).Where("username = ?", username))
+}
+
+// FindByEmail returns the user by email
+func (r *GormRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	return r.first(r.conn(ctx).Where("email = ?", email))
+}
+
+func (r *GormRepository) first(q *gorm.DB) (User, error) {
+	u := User{}
+	err := q.First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// Save writes every field of the user
+func (r *GormRepository) Save(ctx context.Context, u *User) error {
+	return writeError(r.conn(ctx).Save(u).Error)
+}
+
+// Update writes only the named fields of the user
+func (r *GormRepository) Update(ctx context.Context, u *User, fields ...string) error {
+	return writeError(r.conn(ctx).Model(u).Select(fields).Updates(u).Error)
+}
+
+// writeError turns a violation of the unique username index into
+// ErrUsernameTaken
+func writeError(err error) error {
+	if database.IsUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// MarkVerified sets the email of the user as verified
+func (r *GormRepository) MarkVerified(ctx context.Context, id uint, email string) error {
+	result := r.conn(ctx).Model(&User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("verified_at", time.Now().UTC())
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return result.Error
+}
+
+// AdvanceTOTPStep records the TOTP step as used, the step is compared in
+// the update so only one of concurrent requests wins
+func (r *GormRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := r.conn(ctx).Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// Delete removes the user row, users have no DeletedAt so it is not a
+// soft delete
+func (r *GormRepository) Delete(ctx context.Context, u *User) error {
+	return r.conn(ctx).Delete(u).Error
+}
+
+// WithinTx runs fn in a database transaction, other gorm writes join it
+// through database.Conn with the context passed to fn
+func (r *GormRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(database.WithTx(ctx, tx))
+	})
+}
+
+// conn returns the transaction of the context, or the database
+func (r *GormRepository) conn(ctx context.Context) *gorm.DB {
+	return database.Conn(ctx, r.DB)
+}
@@ -0,0 +1,210 @@
+package user
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps users in process memory. It is meant for tests,
+// users are lost on restart.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	users  map[uint]User
+	nextID uint
+}
+
+// NewMemoryRepository creates empty in-memory user repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		users:  map[uint]User{},
+		nextID: 1,
+	}
+}
+
+// Create inserts the user and sets its id, a preset id is kept
+func (m *MemoryRepository) Create(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.taken(u) {
+		return ErrUsernameTaken
+	}
+	if u.ID == 0 {
+		u.ID = m.nextID
+	}
+	if u.ID >= m.nextID {
+		m.nextID = u.ID + 1
+	}
+	now := time.Now()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	m.users[u.ID] = *u
+	return nil
+}
+
+// List returns every user ordered by id
+func (m *MemoryRepository) List(ctx context.Context) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// Get returns the user by id
+func (m *MemoryRepository) Get(ctx context.Context, id uint) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// FindByUsername returns the user by username
+func (m *MemoryRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	return m.find(func(u User) bool { return u.Username == username })
+}
+
+// FindByEmail returns the user by email
+func (m *MemoryRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	return m.find(func(u User) bool { return u.Email == email })
+}
+
+// find returns the user with the lowest id matching, as the database
+// would by primary key order
+func (m *MemoryRepository) find(match func(User) bool) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := User{}
+	for _, u := range m.users {
+		if match(u) && (found.ID == 0 || u.ID < found.ID) {
+			found = u
+		}
+	}
+	if found.ID == 0 {
+		return User{}, ErrUserNotFound
+	}
+	return found, nil
+}
+
+// Save writes every field of the user
+func (m *MemoryRepository) Save(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.ID]; !ok {
+		return ErrUserNotFound
+	}
+	if m.taken(u) {
+		return ErrUsernameTaken
+	}
+	u.UpdatedAt = time.Now()
+	m.users[u.ID] = *u
+	return nil
+}
+
+// Update writes only the named fields of the user, fields are named as
+// in the User struct
+func (m *MemoryRepository) Update(ctx context.Context, u *User, fields ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	src := reflect.ValueOf(u).Elem()
+	dst := reflect.ValueOf(&stored).Elem()
+	for _, f := range fields {
+		dst.FieldByName(f).Set(src.FieldByName(f))
+	}
+	if m.taken(&stored) {
+		return ErrUsernameTaken
+	}
+	stored.UpdatedAt = time.Now()
+	m.users[u.ID] = stored
+	return nil
+}
+
+// MarkVerified sets the email of the user as verified
+func (m *MemoryRepository) MarkVerified(ctx context.Context, id uint, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok || u.Email != email {
+		return ErrUserNotFound
+	}
+	now := time.Now().UTC()
+	u.VerifiedAt = &now
+	m.users[id] = u
+	return nil
+}
+
+// AdvanceTOTPStep records the TOTP step as used
+func (m *MemoryRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok || u.TOTPLastStep >= step {
+		return false, nil
+	}
+	u.TOTPLastStep = step
+	m.users[id] = u
+	return true, nil
+}
+
+// taken reports whether another user has the username of u, as the
+// unique index of the database would
+func (m *MemoryRepository) taken(u *User) bool {
+	for id, other := range m.users {
+		if id != u.ID && other.Username == u.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the user
+func (m *MemoryRepository) Delete(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, u.ID)
+	return nil
+}
+
+// WithinTx runs fn and restores the users as they were before it when
+// fn returns an error. Writes made concurrently by others are undone too.
+func (m *MemoryRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	users := make(map[uint]User, len(m.users))
+	for id, u := range m.users {
+		users[id] = u
+	}
+	nextID := m.nextID
+	m.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		m.mu.Lock()
+		m.users = users
+		m.nextID = nextID
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
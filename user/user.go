@@ -1,13 +1,18 @@
 package user
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
 	"example.com/social-gin/logger"
+	"example.com/social-gin/password"
+	"example.com/social-gin/rbac"
+	"example.com/social-gin/validation"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -15,19 +20,54 @@ import (
 
 // User represents user data
 type User struct {
-	ID        uint         `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"update_at"`
-	DeletedAt sql.NullTime `gorm:"index" json:"-"`
-	Username  string       `gorm:"uniquekey" json:"username"`
-	Password  string       `json:"password"`
-	Name      string       `json:"name"`
-	Email     string       `json:"email"`
+	ID         uint         `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"update_at"`
+	DeletedAt  sql.NullTime `gorm:"index" json:"-"`
+	Username   string       `gorm:"size:100;uniqueIndex" json:"username"`
+	Password   string       `json:"-"`
+	Name       string       `json:"name"`
+	Email      string       `json:"email"`
+	VerifiedAt *time.Time   `json:"verified_at"`
+	Role       string       `gorm:"size:20;default:user" json:"role"`
+	// TOTPSecret is set on enrollment, 2FA is only required once TOTPEnabled
+	// is set by confirming a first code. TOTPLastStep prevents code replay.
+	TOTPSecret   string `gorm:"size:64" json:"-"`
+	TOTPEnabled  bool   `json:"-"`
+	TOTPLastStep int64  `json:"-"`
+}
+
+// errors of user handlers
+var (
+	ErrInvalidUserID = apperror.BadRequest(apperror.CodeInvalidParam, "invalid user id")
+	ErrUserNotFound  = apperror.NotFound("user_not_found", "user not found")
+	ErrUsernameTaken = apperror.Conflict("username_taken", "username is already taken")
+	errUnknownRole   = apperror.BadRequest("unknown_role", "unknown role")
+)
+
+// SessionRevoker revokes the sessions of a user, RevokeCredentials also
+// revokes their API keys and OAuth tokens
+type SessionRevoker interface {
+	RevokeAll(ctx context.Context, uid uint) error
+	RevokeCredentials(ctx context.Context, uid uint) error
+}
+
+// EmailVerifier sends the user a token proving they own their email
+type EmailVerifier interface {
+	SendVerification(ctx context.Context, u User) error
 }
 
 // Handler represents handler of user data
 type Handler struct {
-	DB *gorm.DB
+	// DB is only used to list the tables of Models, users are stored in
+	// Users
+	DB       *gorm.DB
+	Models   []interface{}
+	Users    UserRepository
+	Hasher   password.Hasher
+	Sessions SessionRevoker
+	Verifier EmailVerifier
+	Audit    *audit.Log
 }
 
 // Hello handles hello request
@@ -45,101 +85,78 @@ func (h *Handler) ListTable(c *gin.Context) {
 	uid := c.GetString("uid")
 	logger.Info("listing table", zap.String("uid", uid))
 
-	rows, err := h.DB.Raw("sp_tables").Rows()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
+	// the migrator answers on every database, unlike the catalog views
 	tables := []string{}
-	var tableQualifier sql.NullString
-	var tableOwner sql.NullString
-	var tableName sql.NullString
-	var tableType sql.NullString
-	var remarks sql.NullString
-	for rows.Next() {
-
-		if err := rows.Scan(&tableQualifier, &tableOwner, &tableName, &tableType, &remarks); err != nil {
-			c.JSON(http.StatusBadRequest, map[string]interface{}{
-				"error": err.Error(),
-			})
+	for _, m := range h.Models {
+		stmt := &gorm.Statement{DB: h.DB}
+		if err := stmt.Parse(m); err != nil {
+			apperror.Abort(c, err)
 			return
 		}
-		tables = append(tables, tableName.String)
+		if h.DB.Migrator().HasTable(m) {
+			tables = append(tables, stmt.Schema.Table)
+		}
 	}
 	c.JSON(http.StatusOK, tables)
 }
 
 // AddUser handle add user request
 func (h *Handler) AddUser(c *gin.Context) {
-	user := User{}
-	if err := c.Bind(&user); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	req := CreateUserRequest{}
+	if !validation.Bind(c, &req) {
 		return
 	}
 
-	if user.Username == "" {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "username is empty",
-		})
+	hash, err := h.Hasher.Hash(req.Password)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if user.Password == "" {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "password is empty",
-		})
-		return
+	user := User{
+		Username: req.Username,
+		Password: hash,
+		Name:     req.Name,
+		Email:    req.Email,
+		Role:     rbac.RoleUser,
 	}
 
-	if result := h.DB.Create(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.Users.Create(c.Request.Context(), &user); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	h.record(c, audit.ActionUserCreate, user, "")
+	h.sendVerification(c, user)
+	c.JSON(http.StatusOK, user.Private())
 }
 
 // ListUser handle list user request
 func (h *Handler) ListUser(c *gin.Context) {
-	users := []User{}
-	if result := h.DB.Find(&users); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	users, err := h.Users.List(c.Request.Context())
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, users)
+	profiles := make([]PublicUser, 0, len(users))
+	for _, u := range users {
+		profiles = append(profiles, u.Public())
+	}
+	c.JSON(http.StatusOK, profiles)
 }
 
 // GetUser handle list user request
 func (h *Handler) GetUser(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, ErrInvalidUserID)
 		return
 	}
-	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	user, err := h.Users.Get(c.Request.Context(), uint(uid))
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, Profile(c, user))
 }
 
 // UpdateUser handle update user request
@@ -147,30 +164,17 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, ErrInvalidUserID)
 		return
 	}
-	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	user, err := h.Users.Get(c.Request.Context(), uint(uid))
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	updateUser := User{}
-	if err := c.Bind(&updateUser); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	updateUser := UpdateUserRequest{}
+	if !validation.Bind(c, &updateUser) {
 		return
 	}
 
@@ -179,22 +183,44 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		user.Username = updateUser.Username
 	}
 	if updateUser.Password != "" {
-		user.Password = updateUser.Password
+		hash, err := h.Hasher.Hash(updateUser.Password)
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		user.Password = hash
 	}
 	if updateUser.Name != "" {
 		user.Name = updateUser.Name
 	}
-	if updateUser.Email != "" {
+	// a new email has to be verified again
+	emailChanged := updateUser.Email != "" && updateUser.Email != user.Email
+	if emailChanged {
 		user.Email = updateUser.Email
+		user.VerifiedAt = nil
 	}
 
-	if result := h.DB.Save(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.Users.Save(c.Request.Context(), &user); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+
+	// a new password invalidates every outstanding session and credential
+	if updateUser.Password != "" {
+		if err := h.revokeCredentials(c, user.ID); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	}
+	if updateUser.Password != "" {
+		h.record(c, audit.ActionPasswordChange, user, "")
+	} else {
+		h.record(c, audit.ActionUserUpdate, user, "")
+	}
+	if emailChanged {
+		h.sendVerification(c, user)
+	}
+	c.JSON(http.StatusOK, Profile(c, user))
 }
 
 // DeleteUser handle delete user request
@@ -202,30 +228,100 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, ErrInvalidUserID)
 		return
 	}
-	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	user, err := h.Users.Get(c.Request.Context(), uint(uid))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.Users.Delete(c.Request.Context(), &user); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result := h.DB.Delete(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if err := h.revokeCredentials(c, user.ID); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	h.record(c, audit.ActionUserDelete, user, "")
+	c.JSON(http.StatusOK, Profile(c, user))
+}
+
+// UpdateRole handle update user role request
+func (h *Handler) UpdateRole(c *gin.Context) {
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, ErrInvalidUserID)
+		return
+	}
+
+	req := UpdateRoleRequest{}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if !rbac.Valid(req.Role) {
+		apperror.Abort(c, errUnknownRole)
+		return
+	}
+
+	user, err := h.Users.Get(c.Request.Context(), uint(uid))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	previous := user.Role
+	user.Role = req.Role
+	if err := h.Users.Update(c.Request.Context(), &user, "Role"); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	// sessions carry the role they were created with
+	if err := h.revokeSessions(c, user.ID); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.record(c, audit.ActionRoleUpdate, user, previous+" to "+req.Role)
+	c.JSON(http.StatusOK, user.Private())
+}
+
+// record writes a change of the user to the audit log
+func (h *Handler) record(c *gin.Context, action string, u User, detail string) {
+	h.Audit.Record(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(int(u.ID)),
+		Detail:     detail,
+	})
+}
+
+func (h *Handler) revokeSessions(c *gin.Context, uid uint) error {
+	if h.Sessions == nil {
+		return nil
+	}
+	return h.Sessions.RevokeAll(c.Request.Context(), uid)
+}
+
+func (h *Handler) revokeCredentials(c *gin.Context, uid uint) error {
+	if h.Sessions == nil {
+		return nil
+	}
+	return h.Sessions.RevokeCredentials(c.Request.Context(), uid)
+}
+
+// sendVerification mails the user a verification token, a failure is only
+// logged since the account is already saved and the email can be changed
+// again to retry
+func (h *Handler) sendVerification(c *gin.Context, u User) {
+	if h.Verifier == nil || u.Email == "" {
+		return
+	}
+	if err := h.Verifier.SendVerification(c.Request.Context(), u); err != nil {
+		logger.Extract(c).Error("can't send verification email", zap.Uint("uid", u.ID), zap.Error(err))
+	}
 }
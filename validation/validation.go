@@ -0,0 +1,155 @@
+// Package validation binds request bodies and reports rule violations of
+// their binding tags as a list of field errors
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// limits of the custom rules
+const (
+	UsernameMin = 3
+	UsernameMax = 40
+	PasswordMin = 8
+	// PasswordMax is the most bcrypt uses, longer passwords are truncated
+	PasswordMax = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// FieldError describes a field that broke a rule. Code names the rule,
+// such as required, max or password, so clients can react to it.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errors of Bind, validation failures list the broken rules in fields
+var (
+	ErrInvalidBody = apperror.BadRequest(apperror.CodeInvalidBody, "request body is malformed")
+	ErrValidation  = apperror.BadRequest(apperror.CodeValidation, "validation failed")
+)
+
+var register sync.Once
+
+// Register adds the custom rules to the validator of gin binding and names
+// fields by their json tags. Bind calls it, it only needs to be called
+// directly to validate outside a request.
+func Register() {
+	register.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+		v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+			return Username(fl.Field().String())
+		})
+		v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+			return Password(fl.Field().String())
+		})
+	})
+}
+
+// Username reports whether s is 3 to 40 letters, digits, dots, dashes or
+// underscores
+func Username(s string) bool {
+	return len(s) >= UsernameMin && len(s) <= UsernameMax && usernamePattern.MatchString(s)
+}
+
+// Password reports whether s is strong enough: 8 to 72 bytes mixing at
+// least two of lower case, upper case, digits and symbols
+func Password(s string) bool {
+	if len([]rune(s)) < PasswordMin || len(s) > PasswordMax {
+		return false
+	}
+	var lower, upper, digit, symbol int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower+upper+digit+symbol >= 2
+}
+
+// Bind decodes the request body into obj and validates it. On failure it
+// aborts the request with a 400 error and returns false.
+func Bind(c *gin.Context, obj interface{}) bool {
+	Register()
+	err := c.ShouldBind(obj)
+	if err == nil {
+		return true
+	}
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		apperror.Abort(c, ErrInvalidBody.Wrap(err))
+		return false
+	}
+	apperror.Abort(c, ErrValidation.With("fields", Fields(errs)))
+	return false
+}
+
+// Fields converts validator errors to field errors
+func Fields(errs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, FieldError{
+			Field:   e.Field(),
+			Code:    e.Tag(),
+			Message: message(e),
+		})
+	}
+	return fields
+}
+
+func message(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return e.Field() + " is required"
+	case "min":
+		if e.Kind() == reflect.String {
+			return e.Field() + " must be at least " + e.Param() + " characters"
+		}
+		return e.Field() + " must be at least " + e.Param()
+	case "max":
+		if e.Kind() == reflect.String {
+			return e.Field() + " must be at most " + e.Param() + " characters"
+		}
+		return e.Field() + " must be at most " + e.Param()
+	case "email":
+		return e.Field() + " must be a valid email address"
+	case "username":
+		return e.Field() + " must be 3 to 40 letters, digits, dots, dashes or underscores"
+	case "password":
+		return e.Field() + " must be 8 to 72 characters mixing at least two of lower case, upper case, digits and symbols"
+	}
+	return e.Field() + " is invalid"
+}
@@ -0,0 +1,134 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/post"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsername(t *testing.T) {
+	assert.True(t, validation.Username("sert4"))
+	assert.True(t, validation.Username("sert.k-r_b"))
+	assert.False(t, validation.Username("ab"))
+	assert.False(t, validation.Username("a b c"))
+	assert.False(t, validation.Username("sert@example"))
+	assert.False(t, validation.Username(strings.Repeat("a", 41)))
+}
+
+func TestPassword(t *testing.T) {
+	assert.True(t, validation.Password("test_pass"))
+	assert.True(t, validation.Password("1234567890ab"))
+	assert.True(t, validation.Password("Password"))
+	assert.False(t, validation.Password("1234567890"))
+	assert.False(t, validation.Password("abcdefghij"))
+	assert.False(t, validation.Password("ab12"))
+	assert.False(t, validation.Password(strings.Repeat("a1", 37)))
+}
+
+// bind responds with the bound request when it is valid
+func bind(newReq func() interface{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apperror.Middleware())
+	r.POST("/", func(c *gin.Context) {
+		req := newReq()
+		if !validation.Bind(c, req) {
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	})
+	return r
+}
+
+func send(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBindReportsFieldErrors(t *testing.T) {
+	r := bind(func() interface{} { return &user.CreateUserRequest{} })
+
+	rec := send(r, `{"username":"a b","password":"12345678","email":"not-an-email"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.Equal(t, apperror.ContentType, rec.Header().Get("Content-Type"))
+	res := struct {
+		apperror.Problem
+		Fields []validation.FieldError `json:"fields"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, apperror.CodeValidation, res.Code)
+	assert.Equal(t, http.StatusBadRequest, res.Status)
+
+	codes := map[string]string{}
+	for _, f := range res.Fields {
+		codes[f.Field] = f.Code
+		assert.NotEmpty(t, f.Message)
+	}
+	assert.Equal(t, map[string]string{
+		"username": "username",
+		"password": "password",
+		"email":    "email",
+	}, codes)
+
+	rec = send(r, `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"username","code":"required"`)
+	assert.Contains(t, rec.Body.String(), `"field":"password","code":"required"`)
+
+	rec = send(r, `{"username":"testAddUser","password":"test_pass","name":"test names","email":"test@example.com"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestBindUpdateLeavesEmptyFields(t *testing.T) {
+	r := bind(func() interface{} { return &user.UpdateUserRequest{} })
+
+	rec := send(r, `{"name":"only the name"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = send(r, `{"password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"password"`)
+}
+
+func TestBindPostContent(t *testing.T) {
+	r := bind(func() interface{} { return &post.PostRequest{} })
+
+	rec := send(r, `{"content":""}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"content","code":"required"`)
+
+	rec = send(r, `{"content":"`+strings.Repeat("a", 1001)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"content","code":"max"`)
+
+	rec = send(r, `{"content":"hello","likes":-1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"likes","code":"min"`)
+
+	rec = send(r, `{"content":"hello"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestBindMalformedBody(t *testing.T) {
+	r := bind(func() interface{} { return &user.CreateUserRequest{} })
+
+	rec := send(r, `{"username":`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"invalid_body"`)
+	assert.NotContains(t, rec.Body.String(), "fields")
+	// the decoder error is logged, not returned
+	assert.NotContains(t, rec.Body.String(), "EOF")
+}